@@ -0,0 +1,91 @@
+package alpaca
+
+import (
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// AdditionalProperties decides what happens to submitted object properties the schema does not describe.
+// Only object fields with properties are checked. Objects without properties and any fields are free-form,
+// so whatever they are given is kept as submitted.
+type AdditionalProperties string
+
+const (
+	// AdditionalPropertiesStrip removes undescribed properties from the data and the parsed output
+	AdditionalPropertiesStrip AdditionalProperties = ""
+	// AdditionalPropertiesReject makes New return an AdditionalPropertiesError listing the undescribed properties
+	AdditionalPropertiesReject AdditionalProperties = "reject"
+	// AdditionalPropertiesAllow keeps undescribed properties and passes them through to the parsed output unchanged
+	AdditionalPropertiesAllow AdditionalProperties = "allow"
+)
+
+// additionalProperty is a submitted property of an object field that the schema does not describe
+type additionalProperty struct {
+	Field *Field
+	Key   string
+	Value interface{}
+}
+
+// AdditionalPropertiesError lists the paths of submitted properties the schema does not describe
+type AdditionalPropertiesError struct {
+	Paths []string
+}
+
+func (e *AdditionalPropertiesError) Error() string {
+	return strings.TrimSuffix(ErrAdditionalProperties.Error(), ".") + ": " + strings.Join(e.Paths, ", ")
+}
+
+// Unwrap returns ErrAdditionalProperties so it can be matched with errors.Is
+func (e *AdditionalPropertiesError) Unwrap() error {
+	return ErrAdditionalProperties
+}
+
+// AllowsAdditionalProperties reports whether the schema of an object field accepts any property.
+// Objects without properties describe none of their keys, so they accept any unless additionalProperties says otherwise.
+func (f *Field) AllowsAdditionalProperties() bool {
+	if !f.Schema.Exists("additionalProperties") {
+		return !f.Schema.Exists("properties")
+	}
+	if _, ok := f.Schema.S("additionalProperties").Data().(map[string]interface{}); ok {
+		return true
+	}
+	return cast.ToBool(f.Schema.S("additionalProperties").Data())
+}
+
+// ResolveAdditionalProperties finds the submitted properties of an object field missing from its schema
+// and strips or records them according to the configured mode. Properties the schema allows always pass through.
+func (a *Alpaca) ResolveAdditionalProperties(f *Field) {
+	object, ok := f.Data.Data().(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	allowed := f.AllowsAdditionalProperties()
+	for _, key := range a.order.objectKeys(object) {
+		if f.Schema.Exists("properties", key) {
+			continue
+		}
+		if allowed {
+			a.additional = append(a.additional, additionalProperty{Field: f, Key: key, Value: object[key]})
+			continue
+		}
+
+		path := GetChildPathString(f, key)
+		a.AdditionalPaths = append(a.AdditionalPaths, path)
+		if a.strictMode == AdditionalPropertiesStrip {
+			delete(object, key)
+			continue
+		}
+		a.additional = append(a.additional, additionalProperty{Field: f, Key: key, Value: object[key]})
+	}
+}
+
+// MergeAdditionalProperties writes passed through properties into generated output
+func (a *Alpaca) MergeAdditionalProperties(output interface{}) interface{} {
+	for _, property := range a.additional {
+		segments := append(property.Field.dataSegments(), dataSegment{Key: property.Key})
+		output = setIn(output, segments, property.Value)
+	}
+	return output
+}
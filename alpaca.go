@@ -6,9 +6,9 @@ import (
 	"fmt"
 	"image"
 	"io"
-	"math"
 	"mime"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -22,55 +22,139 @@ import (
 	"github.com/Jeffail/gabs"
 )
 
+// DefaultMaxDepth bounds how deeply fields may be nested, as every field holds the path to it
+const DefaultMaxDepth = 32
+
 // New initalizes and returns new alpaca parser
 func New(options AlpacaOptions) (*Alpaca, error) {
 
-	if (AlpacaOptions{}) == options {
+	if options.Schema == "" && options.Data == "" && options.Request == nil {
 		return nil, ErrDefaultError
 	}
 
 	alpaca := &Alpaca{}
 
-	schema, err := gabs.ParseJSON([]byte(options.Schema))
+	schema, order, err := decodeOrdered([]byte(options.Schema))
 	if err != nil {
 		return nil, ErrSchemaInvalid
 	}
 
-	data, err := gabs.ParseJSON([]byte(options.Data))
+	data, dataOrder, err := decodeOrdered([]byte(options.Data))
 	if err != nil {
 		return nil, ErrDataInvalid
 	}
+	order.merge(dataOrder)
 
 	alpaca.schema = schema.Search("schema")
 	alpaca.options = schema.Search("options")
 	if alpaca.options == nil {
 		alpaca.options = gabs.New()
 	}
+	alpaca.order = order
 	alpaca.data = data
 
 	if options.Request != nil {
 		alpaca.request = options.Request
 	}
 
+	alpaca.coerce = options.Coerce
+	alpaca.checkboxFormat = options.CheckboxFormat
+	alpaca.idStrategy = options.IDStrategy
+
+	alpaca.strictMode = options.AdditionalProperties
+	alpaca.refLoader = options.RefLoader
+	alpaca.maxRefDepth = options.MaxRefDepth
+	if alpaca.maxRefDepth <= 0 {
+		alpaca.maxRefDepth = DefaultMaxRefDepth
+	}
+	alpaca.maxDepth = options.MaxDepth
+	if alpaca.maxDepth <= 0 {
+		alpaca.maxDepth = DefaultMaxDepth
+	}
+	alpaca.protect = options.Protect
+	alpaca.serverValues = map[string]interface{}{}
+	for pointer, value := range options.ServerValues {
+		alpaca.serverValues[pointer] = value
+	}
+
+	// The request timezone takes precedence over the form timezone
+	alpaca.dateTime = options.DateTime
+	alpaca.location = options.DateTime.Location
+	if alpaca.location == nil && alpaca.options.Exists("timezone") {
+		location, err := time.LoadLocation(cast.ToString(alpaca.options.S("timezone").Data()))
+		if err != nil {
+			return nil, ErrTimezoneInvalid
+		}
+		alpaca.location = location
+	}
+
+	if err := alpaca.build(); err != nil {
+		return nil, err
+	}
+
+	return alpaca, nil
+}
+
+// build registers the fields described by the schema and data, replacing any previously registered fields
+func (a *Alpaca) build() error {
+	a.FieldRegistry = nil
+	a.MediaRegistry = nil
+	a.fieldIndex = nil
+	a.pointerIndex = nil
+	a.ids = nil
+	a.UniqueIDCounter = 0
+	a.AdditionalPaths = nil
+	a.additional = nil
+	a.output = ""
+	a.refs = nil
+
+	// Objects that were replaced since the last build no longer need their key order
+	values := []interface{}{a.schema.Data(), a.options.Data(), a.data.Data()}
+	for _, document := range a.refDocuments {
+		values = append(values, document.Data())
+	}
+	a.order = a.order.retain(values...)
+
+	schema, options, refs, err := a.resolveRefs(a.schema, a.options)
+	if err != nil {
+		return &FieldError{Err: err}
+	}
+
 	// Kick off the field registration
-	alpaca.CreateFieldInstance("", alpaca.data, alpaca.options, alpaca.schema, nil, 0, false)
+	err = a.CreateFieldInstance("", a.data, options, schema, nil, 0, false)
+	a.releaseRefs(refs)
+	if err != nil {
+		return err
+	}
+
+	if a.strictMode == AdditionalPropertiesReject && len(a.AdditionalPaths) > 0 {
+		return &AdditionalPropertiesError{Paths: a.AdditionalPaths}
+	}
 
-	for _, field := range alpaca.FieldRegistry {
+	for _, field := range a.FieldRegistry {
 		if field.Parent != nil && field.Parent.IsArrayChild {
 			field.IsArrayChild = true
 		}
 	}
 
-	// Sort fields by ordering - This won't work as it ignores array ordering
-	slice.Sort(alpaca.FieldRegistry[:], func(i, j int) bool {
-		return alpaca.FieldRegistry[i].DepthOrder < alpaca.FieldRegistry[j].DepthOrder
+	for _, field := range a.FieldRegistry {
+		if field.Parent == nil {
+			field.SetSortKey(SortKey{})
+		}
+	}
+
+	// Sort fields by their position in the field tree
+	slice.Sort(a.FieldRegistry[:], func(i, j int) bool {
+		return a.FieldRegistry[i].SortKey.Less(a.FieldRegistry[j].SortKey)
 	})
 
-	return alpaca, nil
+	a.indexFields()
+
+	return nil
 }
 
 // ResolveItemSchemaOptions resolves the items in an array container field
-func (a *Alpaca) ResolveItemSchemaOptions(key string, connector *Field, index int) {
+func (a *Alpaca) ResolveItemSchemaOptions(key string, connector *Field, index int) error {
 
 	isInt := false
 	if _, err := strconv.Atoi(key); err == nil {
@@ -98,11 +182,17 @@ func (a *Alpaca) ResolveItemSchemaOptions(key string, connector *Field, index in
 		data = connector.Data
 	}
 
-	a.CreateFieldInstance(cast.ToString(index), data, options, schema, connector, index, true)
+	schema, options, refs, err := a.resolveRefs(schema, options)
+	if err != nil {
+		return &FieldError{Path: GetChildPathString(connector, cast.ToString(index)), Err: err}
+	}
+	defer a.releaseRefs(refs)
+
+	return a.CreateFieldInstance(cast.ToString(index), data, options, schema, connector, index, true)
 }
 
 // ResolvePropertySchemaOptions resolves the properties in an object container field
-func (a *Alpaca) ResolvePropertySchemaOptions(key string, connector *Field) {
+func (a *Alpaca) ResolvePropertySchemaOptions(key string, connector *Field) error {
 
 	schema := gabs.New()
 	if connector.Schema.Exists("properties") && connector.Schema.S("properties").Exists(key) {
@@ -124,7 +214,13 @@ func (a *Alpaca) ResolvePropertySchemaOptions(key string, connector *Field) {
 		data = connector.Data.S(key)
 	}
 
-	a.CreateFieldInstance(key, data, options, schema, connector, 0, false)
+	schema, options, refs, err := a.resolveRefs(schema, options)
+	if err != nil {
+		return &FieldError{Path: GetChildPathString(connector, key), Err: err}
+	}
+	defer a.releaseRefs(refs)
+
+	return a.CreateFieldInstance(key, data, options, schema, connector, 0, false)
 }
 
 // GuessOptionsType determines field type
@@ -143,23 +239,63 @@ func (a *Alpaca) GuessOptionsType(schema *gabs.Container) string {
 		}
 
 	} else {
-		fieldType := schema.S("type").Data()
+		fieldType, _ := GetTypeString(schema.S("type"))
 
-		if fieldType != nil {
-			if fieldType.(string) != "" {
-				optionType = DefaultSchemaFieldMapping[fieldType.(string)]
-			}
+		if fieldType != "" {
+			optionType = DefaultSchemaFieldMapping[fieldType]
 		}
 	}
 
 	// check if it has format defined
 	if schema.Exists("format") == true {
-		optionType = DefaultFormatFieldMapping[schema.S("format").Data().(string)]
+		optionType = DefaultFormatFieldMapping[cast.ToString(schema.S("format").Data())]
 	}
 
 	return optionType
 }
 
+// GetTypeString returns the type named by a schema or options "type" keyword.
+// A list of types such as ["string", "null"] resolves to its first non-null type.
+func GetTypeString(c *gabs.Container) (string, error) {
+	switch v := c.Data().(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []interface{}:
+		result := ""
+		for _, item := range v {
+			itemType, ok := item.(string)
+			if !ok {
+				return "", ErrTypeInvalid
+			}
+			if result == "" && itemType != "null" {
+				result = itemType
+			}
+		}
+		if result == "" && len(v) > 0 {
+			result = "null"
+		}
+		return result, nil
+	}
+
+	return "", ErrTypeInvalid
+}
+
+// GetChildPathString returns the path string of a field created under connector with the given key
+func GetChildPathString(connector *Field, key string) string {
+	if connector == nil {
+		return ""
+	}
+	if connector.ChunkType == "array" || connector.ChunkType == "repeatable" {
+		return connector.PathString + "[" + key + "]"
+	}
+	if connector.PathString == "" {
+		return key
+	}
+	return connector.PathString + "." + key
+}
+
 // GetSchemaType returns schema type of data.
 func (a *Alpaca) GetSchemaType(data *gabs.Container) string {
 	// seems to be returning an array even for strings, thus invalid
@@ -182,19 +318,20 @@ func (a *Alpaca) GetSchemaType(data *gabs.Container) string {
 	return "string"
 }
 
-// GetDepthOrder
-func GetDepthOrder(f *Field, o float64) float64 {
-	if f.Parent != nil {
-		o += GetDepthOrder(f.Parent, o)
-	}
+// SetSortKey orders the children of a field and assigns each its position in the field tree.
+// Children are sorted by options.order, falling back to declaration order for properties and index order for array items.
+func (f *Field) SetSortKey(key SortKey) {
+	f.SortKey = key
 
-	if v, err := strconv.Atoi(f.Key); err == nil {
-		o += float64(v) / math.Pow(10, float64(f.Depth))
-	} else {
-		o += f.Order / math.Pow(10, float64(f.Depth))
-	}
+	sort.SliceStable(f.Children, func(i, j int) bool {
+		return f.Children[i].Order < f.Children[j].Order
+	})
 
-	return o
+	for i, child := range f.Children {
+		childKey := make(SortKey, len(key), len(key)+1)
+		copy(childKey, key)
+		child.SetSortKey(append(childKey, i))
+	}
 }
 
 // GetAttributes extracts generic attributes from fields
@@ -223,8 +360,6 @@ func (f *Field) GetAttributes() {
 		f.Order = cast.ToFloat64(f.Options.S("order").Data()) // / math.Pow(10, float64(f.Depth))
 	}
 
-	f.DepthOrder = GetDepthOrder(f, 0)
-
 	if f.Data.Data() != nil {
 		f.Value = f.Data.Data()
 	}
@@ -236,10 +371,6 @@ func (f *Field) GetAttributes() {
 	if f.Schema.Exists("default") {
 		f.Default = f.Schema.S("default").Data()
 	}
-
-	// if f.ReadOnly {
-	// 	f.Value = f.Default
-	// }
 }
 
 // RegisterField field adds the field to the field registry
@@ -298,13 +429,12 @@ func (a *Alpaca) RegisterMedia(f *Field, index int) {
 }
 
 // CreateFieldInstance returns a new instance of the desired field based on the schema
-func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *gabs.Container, schema *gabs.Container, connector *Field, arrayIndex int, arrayChild bool) {
+func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *gabs.Container, schema *gabs.Container, connector *Field, arrayIndex int, arrayChild bool) error {
 
 	optionsType := ""
-	schemaType := ""
-
-	if schema.Exists("type") != false {
-		schemaType = schema.S("type").Data().(string)
+	schemaType, err := GetTypeString(schema.S("type"))
+	if err != nil {
+		return &FieldError{Path: GetChildPathString(connector, key), Pointer: GetChildPointer(connector, key), Err: err}
 	}
 
 	if options.Exists("type") == false {
@@ -321,8 +451,6 @@ func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *
 		// if nothing passed in, fallback to defaults
 		if schema.Exists("type") == false {
 			optionsType = "object" // fallback
-		} else {
-			schemaType = schema.S("type").Data().(string)
 		}
 
 		optionType := a.GuessOptionsType(schema)
@@ -330,7 +458,10 @@ func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *
 			optionsType = optionType
 		}
 	} else {
-		optionsType = options.S("type").Data().(string)
+		optionsType, err = GetTypeString(options.S("type"))
+		if err != nil {
+			return &FieldError{Path: GetChildPathString(connector, key), Pointer: GetChildPointer(connector, key), Err: err}
+		}
 	}
 
 	f := &Field{
@@ -346,6 +477,7 @@ func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *
 		IsArrayChild: arrayChild,
 		ArrayIndex:   arrayIndex,
 		ArrayValues:  0,
+		alpaca:       a,
 	}
 
 	if optionsType == "select" && schemaType != "" {
@@ -355,6 +487,9 @@ func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *
 	f.GetAttributes()
 
 	if connector != nil {
+		if len(connector.Path) >= a.maxDepth {
+			return &FieldError{Path: GetChildPathString(connector, key), Pointer: GetChildPointer(connector, key), Err: ErrFieldDepth}
+		}
 		for _, chunk := range connector.Path {
 			f.Path = append(f.Path, chunk)
 		}
@@ -374,43 +509,56 @@ func (a *Alpaca) CreateFieldInstance(key string, data *gabs.Container, options *
 	}
 
 	f.PathString = f.GetPathString()
+	f.Pointer = f.GetPointer()
+	f.JSONPath = f.GetJSONPath()
+	f.ID = a.GetFieldID(f)
+
+	if a.coerce {
+		a.Coerce(f)
+	}
+
+	if a.protect {
+		f.GetProtection()
+		a.Protect(f)
+	}
+
+	if err := a.ResolveEnum(f); err != nil {
+		return err
+	}
 
 	// Not all field types are required for definition, many share the same basic behaviour as Any
 	switch f.Type {
-	case "array", "repeatable", "select", "checkbox":
-		a.Array(f)
-		break
+	case "array", "repeatable", "select":
+		err = a.Array(f)
+	case "checkbox":
+		err = a.Checkbox(f)
 	case "datetime":
 		a.Datetime(f)
-		break
+	case "date":
+		a.Date(f)
+	case "time":
+		a.Time(f)
 	case "object":
-		a.Object(f)
-		break
+		err = a.Object(f)
 	case "tag":
 		a.Tag(f)
-		break
 	case "camera":
-		a.Camera(f)
-		break
+		err = a.Camera(f)
 	case "lowercase":
 		a.Lowercase(f)
-		break
 	case "uppercase":
 		a.Uppercase(f)
-		break
 	case "information", "image":
 		a.Information(f)
-		break
 	case "signature":
 		a.Signature(f)
-		break
 	case "editor":
 		a.Editor(f)
-		break
 	case "json":
 		a.JSON(f)
-		break
 	default:
 		a.Any(f)
 	}
+
+	return err
 }
@@ -1,7 +1,30 @@
 package alpaca
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // Core Fields
@@ -656,6 +679,22 @@ func TestDateField(t *testing.T) {
 	if result != `"05/03/2018"` {
 		t.Fatalf(`Should return "05/03/2018", instead returned %s`, result)
 	}
+
+	// Dates kept as submitted are still read in the field's format
+	date, err := alpaca.FieldRegistry[0].Time()
+	if err != nil || date.Format("2006-01-02") != "2018-05-03" {
+		t.Fatalf(`Should return 2018-05-03, instead returned %s (%v)`, date, err)
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: schema, Data: data, DateTime: DateTimeOptions{Normalise: true}})
+	if err != nil {
+		t.Fatalf("TestDateField error: %s", err)
+	}
+
+	result = alpaca.Parse()
+	if result != `"2018-05-03"` {
+		t.Fatalf(`Should return "2018-05-03", instead returned %s`, result)
+	}
 }
 
 func TestDateTimeField(t *testing.T) {
@@ -1305,3 +1344,2054 @@ func TestZipCodeField(t *testing.T) {
 		t.Fatalf(`Should return "53221", instead returned %s`, result)
 	}
 }
+
+func TestFieldRegistryOrder(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"q1": {"type": "string"},
+				"q2": {"type": "string"},
+				"q3": {"type": "string"},
+				"q4": {"type": "string"},
+				"q5": {"type": "string"},
+				"q6": {"type": "string"},
+				"q7": {"type": "string"},
+				"q8": {"type": "string"},
+				"q9": {"type": "string"},
+				"q10": {"type": "string"},
+				"q11": {"type": "string"},
+				"first": {"type": "string"},
+				"items": {
+					"type": "array",
+					"maxItems": 12,
+					"items": {
+						"type": "object",
+						"properties": {
+							"b": {"type": "string"},
+							"a": {"type": "string"}
+						}
+					}
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"first": {
+					"order": -1
+				}
+			}
+		}
+	}`
+	data := `{"q1":"1","q11":"11","items":[{"a":"a0","b":"b0"},{},{},{},{},{},{},{},{},{},{},{"a":"a11"}]}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestFieldRegistryOrder error: %s", err)
+	}
+
+	paths := []string{}
+	for _, f := range alpaca.FieldRegistry {
+		paths = append(paths, f.PathString)
+	}
+
+	expected := []string{"", "first", "q1", "q2", "q3", "q4", "q5", "q6", "q7", "q8", "q9", "q10", "q11", "items", "items[0]", "items[0].b", "items[0].a", "items[1]", "items[1].b", "items[1].a"}
+	for i, path := range expected {
+		if paths[i] != path {
+			t.Fatalf(`Should return %v, instead returned %v`, expected, paths[:len(expected)])
+		}
+	}
+
+	if paths[len(paths)-3] != "items[11]" || paths[len(paths)-1] != "items[11].a" {
+		t.Fatalf(`Should end with items[11], instead returned %v`, paths[len(paths)-3:])
+	}
+}
+
+func TestKeyOrderRebuild(t *testing.T) {
+	schema := `{"schema":{"type":"object","properties":{"site":{"type":"string"}}}}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: `{"site":"a","zeta":1,"alpha":2}`, AdditionalProperties: AdditionalPropertiesAllow})
+	if err != nil {
+		t.Fatalf("TestKeyOrderRebuild error: %s", err)
+	}
+	recorded := len(alpaca.order)
+
+	// Every mutation copies the data, so the orders of the objects it replaced are dropped
+	for i := 0; i < 20; i++ {
+		if err := alpaca.SetValue("site", fmt.Sprint(i)); err != nil {
+			t.Fatalf("TestKeyOrderRebuild error: %s", err)
+		}
+	}
+	if len(alpaca.order) != recorded {
+		t.Fatalf(`Should record %d key orders, instead recorded %d`, recorded, len(alpaca.order))
+	}
+	if len(alpaca.AdditionalPaths) != 2 || alpaca.AdditionalPaths[0] != "zeta" || alpaca.AdditionalPaths[1] != "alpha" {
+		t.Fatalf(`Should return [zeta alpha], instead returned %v`, alpaca.AdditionalPaths)
+	}
+}
+
+func TestParseFormOrder(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"name": {
+					"type": "string"
+				},
+				"age": {
+					"type": "number"
+				},
+				"nest": {
+					"type": "array",
+					"maxItems": 2,
+					"items": {
+						"type": "object",
+						"properties": {
+							"zeta": {
+								"type": "string"
+							},
+							"alpha": {
+								"type": "string"
+							}
+						}
+					}
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"name": {
+					"order": 1
+				},
+				"age": {
+					"order": 2
+				},
+				"nest": {
+					"order": 3
+				}
+			}
+		}
+	}`
+	data := `{"nest":[{"alpha":"a","zeta":"z"},{"zeta":"y"}],"age":4,"name":"test3"}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestParseFormOrder error: %s", err)
+	}
+
+	result, err := alpaca.ParseWith(ParseOptions{FormOrder: true})
+	if err != nil {
+		t.Fatalf("TestParseFormOrder error: %s", err)
+	}
+	if result != `{"name":"test3","age":4,"nest":[{"zeta":"z","alpha":"a"},{"zeta":"y"}]}` {
+		t.Fatalf(`Should return {"name":"test3","age":4,"nest":[{"zeta":"z","alpha":"a"},{"zeta":"y"}]}, instead returned %s`, result)
+	}
+
+	result = alpaca.Parse()
+	if result != `{"age":4,"name":"test3","nest":[{"alpha":"a","zeta":"z"},{"zeta":"y"}]}` {
+		t.Fatalf(`Should return {"age":4,"name":"test3","nest":[{"alpha":"a","zeta":"z"},{"zeta":"y"}]}, instead returned %s`, result)
+	}
+}
+
+func TestMalformedSchemaErrors(t *testing.T) {
+	tests := []struct {
+		schema string
+		data   string
+		path   string
+		err    error
+	}{
+		{`{"schema":{"type":"object","properties":{"name":{"type":5}}}}`, `{"name":"test"}`, "name", ErrTypeInvalid},
+		{`{"schema":{"type":"object","properties":{"name":{"type":"string"}}},"options":{"fields":{"name":{"type":true}}}}`, `{"name":"test"}`, "name", ErrTypeInvalid},
+		{`{"schema":{"type":"object","properties":{"list":{"type":"array","maxItems":"many","items":{"type":"string"}}}}}`, `{"list":["a"]}`, "list", ErrMaxItemsInvalid},
+		{`{"schema":{"type":"object","properties":{"list":{"type":"array","items":{"type":"object","properties":{"flavour":{"type":"string","enum":["a","b"]}}}}}},"options":{"fields":{"list":{"items":{"fields":{"flavour":{"type":"select","optionLabels":["A"]}}}}}}}`, `{"list":[{"flavour":"b"}]}`, "list[0].flavour", ErrOptionLabelsInvalid},
+	}
+
+	for _, test := range tests {
+		_, err := New(AlpacaOptions{Schema: test.schema, Data: test.data})
+		if !errors.Is(err, test.err) {
+			t.Fatalf(`Should return %s, instead returned %v`, test.err, err)
+		}
+		fieldErr, ok := err.(*FieldError)
+		if !ok || fieldErr.Path != test.path {
+			t.Fatalf(`Should return error at %s, instead returned %v`, test.path, err)
+		}
+	}
+
+	alpaca, err := New(AlpacaOptions{Schema: `{"schema":{"type":["string","null"]}}`, Data: `"test"`})
+	if err != nil {
+		t.Fatalf("TestMalformedSchemaErrors error: %s", err)
+	}
+
+	result, err := alpaca.ParseE()
+	if err != nil || result != `"test"` {
+		t.Fatalf(`Should return "test", instead returned %s %v`, result, err)
+	}
+
+	if _, err := (&Alpaca{}).ParseE(); err != ErrNoFields {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrNoFields, err)
+	}
+}
+
+func TestArraySubmittedItems(t *testing.T) {
+	schema := `{"schema":{"type":"object","properties":{"list":{"type":"array","maxItems":3,"items":{"type":"object","properties":{"name":{"type":"string"}}}}}}}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: `{"list":[{"name":"a"},{"name":"b"}]}`})
+	if err != nil {
+		t.Fatalf("TestArraySubmittedItems error: %s", err)
+	}
+	if alpaca.FieldByPath("list[1].name") == nil || alpaca.FieldByPath("list[2]") != nil || alpaca.FieldByPath("list[2].name") != nil {
+		t.Fatalf(`Should only register the submitted items, instead returned %d fields`, len(alpaca.FieldRegistry))
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: schema, Data: `{}`})
+	if err != nil {
+		t.Fatalf("TestArraySubmittedItems error: %s", err)
+	}
+	if result := alpaca.FieldByPath("list"); result == nil || len(result.Children) != 0 {
+		t.Fatalf(`Should register an empty array when no items were submitted, instead returned %v`, result)
+	}
+}
+
+func TestCheckboxItemsEnum(t *testing.T) {
+	schema := `{"schema":{"type":"object","properties":{"site":{"type":"string"},"tags":{"type":"array","items":{"type":"string","enum":["a","b","c"]}}}},"options":{"fields":{"tags":{"type":"checkbox"}}}}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: `{"site":"x","tags":["a","c"]}`})
+	if err != nil {
+		t.Fatalf("TestCheckboxItemsEnum error: %s", err)
+	}
+
+	// The checkbox's items must not overwrite its answer
+	result := alpaca.Parse()
+	if result != `{"site":"x","tags":["a","c"]}` {
+		t.Fatalf(`Should return {"site":"x","tags":["a","c"]}, instead returned %s`, result)
+	}
+}
+
+func TestArrayDefaultMaxItems(t *testing.T) {
+	schema := `{"schema":{"type":"object","properties":{"list":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"}}}}}}}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: `{"list":[{"name":"a"}]}`})
+	if err != nil {
+		t.Fatalf("TestArrayDefaultMaxItems error: %s", err)
+	}
+
+	// Arrays without maxItems have no limit
+	for _, name := range []string{"b", "c", "d"} {
+		if err := alpaca.AppendItem("list", map[string]string{"name": name}); err != nil {
+			t.Fatalf(`Should return nil, instead returned %s`, err)
+		}
+	}
+	result := alpaca.Parse()
+	if result != `{"list":[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d"}]}` {
+		t.Fatalf(`Should return {"list":[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d"}]}, instead returned %s`, result)
+	}
+}
+
+func TestArrayItemsWithoutSchema(t *testing.T) {
+	schema := `{"schema":{"type":"object","properties":{"list":{"type":"array","items":{}}}},"options":{"fields":{"list":{"items":{"type":"select"}}}}}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: `{"list":["a"]}`})
+	if err != nil {
+		t.Fatalf("TestArrayItemsWithoutSchema error: %s", err)
+	}
+	// The item resolves its own schema again as list[0].0, which stops there
+	if alpaca.FieldByPath("list[0]") == nil || alpaca.FieldByPath("list[0].0") == nil || len(alpaca.FieldRegistry) != 4 {
+		t.Fatalf(`Should descend into items without a schema once, instead returned %d fields`, len(alpaca.FieldRegistry))
+	}
+}
+
+func TestFieldDepth(t *testing.T) {
+	schema := `{"schema":` + strings.Repeat(`{"type":"object","properties":{"a":`, 3) + `{"type":"string"}` + strings.Repeat(`}}`, 3) + `}`
+	data := `{"a":{"a":{"a":"x"}}}`
+
+	if _, err := New(AlpacaOptions{Schema: schema, Data: data, MaxDepth: 3}); !errors.Is(err, ErrFieldDepth) {
+		t.Fatalf(`Should return ErrFieldDepth, instead returned %v`, err)
+	}
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data, MaxDepth: 4})
+	if err != nil {
+		t.Fatalf("TestFieldDepth error: %s", err)
+	}
+	if result := alpaca.Parse(); result != data {
+		t.Fatalf(`Should return %s, instead returned %s`, data, result)
+	}
+
+	// Deep forms are rejected quickly under the default limit
+	schema = `{"schema":` + strings.Repeat(`{"type":"object","properties":{"a":`, 1000) + `{"type":"string"}` + strings.Repeat(`}}`, 1000) + `}`
+	data = strings.Repeat(`{"a":`, 1000) + `"x"` + strings.Repeat(`}`, 1000)
+	if _, err := New(AlpacaOptions{Schema: schema, Data: data}); !errors.Is(err, ErrFieldDepth) {
+		t.Fatalf(`Should return ErrFieldDepth, instead returned %v`, err)
+	}
+}
+
+func FuzzNewParse(f *testing.F) {
+	f.Add(`{"schema":{"type":"object","properties":{"name":{"type":"string"},"nest":{"type":"array","maxItems":3,"items":{"type":"object","properties":{"name1":{"type":"string"}}}}}},"options":{"fields":{"name":{"order":1}}}}`, `{"name":"test","nest":[{"name1":"a"},{"name1":"b"}]}`)
+	f.Add(`{"schema":{"type":"array","items":{"type":"string","enum":["Vanilla","Chocolate"]},"maxItems":3},"options":{"type":"select","optionLabels":["V"]}}`, `["Vanilla","Chocolate"]`)
+	f.Add(`{"schema":{"type":"object","properties":{"field":{"type":"array","enum":["Fire","Flood"]}}},"options":{"fields":{"field":{"type":"checkbox"}}}}`, `{"field":[{"value":"Fire","text":"Fire"}]}`)
+	f.Add(`{"schema":{"type":["string","null"],"format":"date-time"}}`, `"2019-03-25T10:58"`)
+	f.Add(`{"options":{"type":"json"}}`, `{"test":"test2"}`)
+	f.Add(`{"schema":{"enum":["a","b"]},"options":{"type":"radio","optionLabels":["A"]}}`, `"a"`)
+	f.Add(`{"schema":{"type":"object","properties":{"list":{"type":"array","items":{"type":"object"}}}}}`, `{"list":["x"]}`)
+	f.Add(`{"schema":{"type":"array","items":{}},"options":{"items":{"type":"select"}}}`, `["a"]`)
+	f.Add(`{"schema":{"type":"object","properties":{"o":{"type":"object","properties":{"p":{"type":"array","items":{"type":"array","items":{"type":"string"}}}}}}}}`, `{"o":{"p":[["a"],["b","c"]]}}`)
+	// Every field holds the path to it, so deeply nested forms are rejected rather than taking seconds
+	f.Add(`{"schema":`+strings.Repeat(`{"type":"object","properties":{"a":`, 40)+`{"type":"string"}`+strings.Repeat(`}}`, 40)+`}`, strings.Repeat(`{"a":`, 40)+`"x"`+strings.Repeat(`}`, 40))
+
+	f.Fuzz(func(t *testing.T, schema string, data string) {
+		alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+		if err != nil {
+			return
+		}
+		alpaca.ParseE()
+		alpaca.ParseWith(ParseOptions{FormOrder: true})
+	})
+}
+
+func TestCoerceValues(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"count": {
+					"type": "integer"
+				},
+				"reading": {
+					"type": "number"
+				},
+				"agreed": {
+					"type": "boolean"
+				},
+				"tags": {
+					"type": "array",
+					"items": {
+						"type": "string"
+					}
+				},
+				"code": {
+					"type": "string"
+				},
+				"rating": {
+					"enum": [1, 2, 3]
+				},
+				"broken": {
+					"type": "number"
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"agreed": {
+					"type": "text"
+				},
+				"rating": {
+					"type": "radio"
+				}
+			}
+		}
+	}`
+	data := `{"count":"5","reading":" 2.5","agreed":"on","tags":"urgent","code":42,"rating":"2","broken":"abc"}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data, Coerce: true})
+	if err != nil {
+		t.Fatalf("TestCoerceValues error: %s", err)
+	}
+
+	result := alpaca.Parse()
+	if result != `{"agreed":true,"broken":"abc","code":"42","count":5,"rating":2,"reading":2.5,"tags":["urgent"]}` {
+		t.Fatalf(`Should return {"agreed":true,"broken":"abc","code":"42","count":5,"rating":2,"reading":2.5,"tags":["urgent"]}, instead returned %s`, result)
+	}
+
+	failed := 0
+	for _, coercion := range alpaca.Coercions {
+		if coercion.Err != nil {
+			failed++
+			if coercion.Path != "broken" || coercion.From != "abc" {
+				t.Fatalf(`Should fail to coerce broken, instead failed on %s`, coercion.Path)
+			}
+		}
+	}
+	if len(alpaca.Coercions) != 7 || failed != 1 {
+		t.Fatalf(`Should record 6 coercions and 1 failure, instead recorded %v`, alpaca.Coercions)
+	}
+
+	// Rebuilding after a change keeps one record per path
+	for i := 0; i < 2; i++ {
+		if err := alpaca.SetValue("code", "43"); err != nil {
+			t.Fatalf("TestCoerceValues error: %s", err)
+		}
+	}
+	if len(alpaca.Coercions) != 7 {
+		t.Fatalf(`Should still record 7 coercions, instead recorded %v`, alpaca.Coercions)
+	}
+}
+
+func TestDateTimeNormalisation(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"visited": {
+					"type": "string",
+					"format": "date"
+				},
+				"arrived": {
+					"type": "string",
+					"format": "time"
+				},
+				"reported": {
+					"type": "string",
+					"format": "datetime"
+				},
+				"submitted": {
+					"type": "string",
+					"format": "datetime"
+				},
+				"other": {
+					"type": "string",
+					"format": "datetime"
+				}
+			}
+		},
+		"options": {
+			"timezone": "Europe/London",
+			"fields": {
+				"visited": {
+					"dateFormat": "DD/MM/YYYY"
+				},
+				"arrived": {
+					"dateFormat": "h:mm a"
+				}
+			}
+		}
+	}`
+	data := `{"visited":"25/03/2019","arrived":"2:30 PM","reported":"2019-07-01T09:15:00Z","submitted":"07/01/2019 09:15:00","other":"not a date"}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data, DateTime: DateTimeOptions{Normalise: true, DateTimeFormat: time.RFC3339}})
+	if err != nil {
+		t.Fatalf("TestDateTimeNormalisation error: %s", err)
+	}
+
+	result := alpaca.Parse()
+	if result != `{"arrived":"14:30:00","other":"not a date","reported":"2019-07-01T10:15:00+01:00","submitted":"2019-07-01T09:15:00+01:00","visited":"2019-03-25"}` {
+		t.Fatalf(`Should return {"arrived":"14:30:00","other":"not a date","reported":"2019-07-01T10:15:00+01:00","submitted":"2019-07-01T09:15:00+01:00","visited":"2019-03-25"}, instead returned %s`, result)
+	}
+
+	if layout := MomentToLayout("ddd, MMM D YYYY [at] HH:mm:ss.SSS"); layout != "Mon, Jan 2 2006 at 15:04:05.000" {
+		t.Fatalf(`Should return Mon, Jan 2 2006 at 15:04:05.000, instead returned %s`, layout)
+	}
+
+	if _, err := New(AlpacaOptions{Schema: `{"schema":{"type":"string"},"options":{"timezone":"Nowhere/Special"}}`, Data: `"x"`}); err != ErrTimezoneInvalid {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrTimezoneInvalid, err)
+	}
+}
+
+func TestEnumLabels(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"location": {
+					"type": "string",
+					"enum": ["ext", "int"]
+				},
+				"incidents": {
+					"type": "array",
+					"enum": ["fire", "flood", "theft", "violence"]
+				},
+				"extras": {
+					"type": "string",
+					"enum": ["sandwich", "chips", "cookie", "drink"]
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"location": {
+					"type": "radio",
+					"optionLabels": ["External", "Internal"]
+				},
+				"incidents": {
+					"type": "checkbox",
+					"optionLabels": ["Fire", "Flood", "Theft", "Threat of Violence"]
+				},
+				"extras": {
+					"type": "checkbox"
+				}
+			}
+		}
+	}`
+	data := `{"location":"int","incidents":[{"value":"fire","text":"fire"},{"value":"violence","text":"violence"},{"value":"arson","text":"arson"}],"extras":"chips,drink"}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestEnumLabels error: %s", err)
+	}
+
+	for _, f := range alpaca.FieldRegistry {
+		switch f.Key {
+		case "location":
+			if f.EnumLabel != "Internal" || len(f.Enum) != 2 || len(f.InvalidEnumValues) != 0 {
+				t.Fatalf(`Should return Internal, instead returned %s`, f.EnumLabel)
+			}
+		case "incidents":
+			if len(f.EnumLabels) != 3 || f.EnumLabels[0] != "Fire" || f.EnumLabels[1] != "Threat of Violence" || f.EnumLabels[2] != "arson" {
+				t.Fatalf(`Should return [Fire Threat of Violence arson], instead returned %v`, f.EnumLabels)
+			}
+			if len(f.InvalidEnumValues) != 1 || f.InvalidEnumValues[0] != "arson" {
+				t.Fatalf(`Should flag arson, instead flagged %v`, f.InvalidEnumValues)
+			}
+		case "extras":
+			if f.EnumLabel != "chips, drink" {
+				t.Fatalf(`Should return chips, drink, instead returned %s`, f.EnumLabel)
+			}
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"location": {
+					"type": "string",
+					"title": "Location",
+					"enum": ["ext", "int"]
+				},
+				"flavours": {
+					"type": "array",
+					"title": "Ice Cream",
+					"maxItems": 3,
+					"items": {
+						"type": "string",
+						"enum": ["v", "c", "s"]
+					}
+				},
+				"comments": {
+					"type": "string",
+					"title": "Comments"
+				},
+				"other_comments": {
+					"type": "string",
+					"title": "Comments"
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"location": {
+					"type": "radio",
+					"optionLabels": ["External", "Internal"],
+					"order": 1
+				},
+				"flavours": {
+					"type": "select",
+					"optionLabels": ["Vanilla", "Chocolate", "Strawberry"],
+					"order": 2
+				},
+				"comments": {
+					"order": 3
+				},
+				"other_comments": {
+					"order": 4
+				}
+			}
+		}
+	}`
+	data := `{"location":"ext","flavours":["v","s"],"comments":"None","other_comments":"Nope"}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestParseLabels error: %s", err)
+	}
+
+	tests := []struct {
+		options  ParseOptions
+		expected string
+	}{
+		{ParseOptions{Labels: true}, `{"comments":"None","flavours":["Vanilla","Strawberry"],"location":"External","other_comments":"Nope"}`},
+		{ParseOptions{Labels: true, Titles: true, FormOrder: true}, `{"Location":"External","Ice Cream":["Vanilla","Strawberry"],"Comments":"None","Comments (other_comments)":"Nope"}`},
+		{ParseOptions{Tuples: true, FormOrder: true}, `{"location":{"key":"location","title":"Location","value":"ext","label":"External"},"flavours":{"key":"flavours","title":"Ice Cream","value":["v","s"],"label":["Vanilla","Strawberry"]},"comments":{"key":"comments","title":"Comments","value":"None","label":"None"},"other_comments":{"key":"other_comments","title":"Comments","value":"Nope","label":"Nope"}}`},
+	}
+
+	for _, test := range tests {
+		result, err := alpaca.ParseWith(test.options)
+		if err != nil {
+			t.Fatalf("TestParseLabels error: %s", err)
+		}
+		if result != test.expected {
+			t.Fatalf(`Should return %s, instead returned %s`, test.expected, result)
+		}
+	}
+
+	radio, err := New(AlpacaOptions{Schema: `{"schema":{"enum":["a","b"]},"options":{"type":"radio","optionLabels":["Apple","Banana"]}}`, Data: `"b"`})
+	if err != nil {
+		t.Fatalf("TestParseLabels error: %s", err)
+	}
+	if result, _ := radio.ParseWith(ParseOptions{Labels: true}); result != `"Banana"` {
+		t.Fatalf(`Should return "Banana", instead returned %s`, result)
+	}
+}
+
+func TestCheckboxFormat(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"field": {
+					"type": "array",
+					"enum": [" Fire", "Flood", "Theft"]
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"field": {
+					"type": "checkbox",
+					"optionLabels": ["Fire", "Flood", "Theft of property"]
+				}
+			}
+		}
+	}`
+	// The enum can also be on the items, as SchemaFromStruct and form.Checkbox write it
+	itemsSchema := strings.Replace(schema, `"enum": [" Fire", "Flood", "Theft"]`, `"items": {"type": "string", "enum": [" Fire", "Flood", "Theft"]}`, 1)
+	shapes := []string{
+		`{"field":["Fire"," Theft","Arson"]}`,
+		`{"field":[{"value":" Fire","text":" Fire"},{"value":"Theft","text":"Theft"},{"value":"Arson","text":"Arson"}]}`,
+		`{"field":"Fire, Theft,Arson"}`,
+	}
+	tests := []struct {
+		format   CheckboxFormat
+		expected string
+	}{
+		{CheckboxFormatArray, `{"field":[" Fire","Theft","Arson"]}`},
+		{CheckboxFormatObjects, `{"field":[{"text":"Fire","value":" Fire"},{"text":"Theft of property","value":"Theft"},{"text":"Arson","value":"Arson"}]}`},
+		{CheckboxFormatString, `{"field":" Fire,Theft,Arson"}`},
+	}
+
+	for _, test := range tests {
+		for _, data := range shapes {
+			for _, form := range []string{schema, itemsSchema} {
+				alpaca, err := New(AlpacaOptions{Schema: form, Data: data, CheckboxFormat: test.format})
+				if err != nil {
+					t.Fatalf("TestCheckboxFormat error: %s", err)
+				}
+
+				result := alpaca.Parse()
+				if result != test.expected {
+					t.Fatalf(`Should return %s from %s, instead returned %s`, test.expected, data, result)
+				}
+
+				for _, f := range alpaca.FieldRegistry {
+					if f.PathString == "field" && (len(f.InvalidEnumValues) != 1 || f.InvalidEnumValues[0] != "Arson") {
+						t.Fatalf(`Should flag Arson, instead flagged %v`, f.InvalidEnumValues)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFieldLookup(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"inspected": {
+					"type": "string",
+					"format": "datetime"
+				},
+				"secure": {
+					"type": "string"
+				},
+				"hazards": {
+					"type": "array",
+					"enum": ["Fire", "Flood", "Theft"]
+				},
+				"list_of_electrical": {
+					"type": "array",
+					"maxItems": 10,
+					"items": {
+						"type": "object",
+						"properties": {
+							"electrical_device": {
+								"type": "string"
+							},
+							"reading": {
+								"type": "number"
+							}
+						}
+					}
+				}
+			}
+		},
+		"options": {
+			"timezone": "Europe/London",
+			"fields": {
+				"hazards": {
+					"type": "checkbox"
+				}
+			}
+		}
+	}`
+	data := `{"inspected":"2019-07-01T09:15:00Z","secure":"yes","hazards":["Fire","Theft"],"list_of_electrical":[{"electrical_device":"Kettle","reading":1.5},{"electrical_device":"Heater"},{"electrical_device":"Fridge","reading":3}]}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestFieldLookup error: %s", err)
+	}
+
+	device := alpaca.FieldByPath("list_of_electrical[2].electrical_device")
+	if device == nil || device.String() != "Fridge" {
+		t.Fatalf(`Should return Fridge, instead returned %v`, device)
+	}
+	if alpaca.FieldByPath("list_of_electrical[5].electrical_device") != nil {
+		t.Fatalf(`Should return nil for a missing item`)
+	}
+
+	readings := alpaca.Fields("list_of_electrical[*].reading")
+	if len(readings) != 3 {
+		t.Fatalf(`Should return 3 readings, instead returned %d`, len(readings))
+	}
+	if reading, err := readings[2].Float(); err != nil || reading != 3 {
+		t.Fatalf(`Should return 3, instead returned %v %v`, reading, err)
+	}
+	if len(alpaca.Fields("?*")) != 4 || len(alpaca.Fields("**device")) != 3 {
+		t.Fatalf(`Should match 4 top level fields and 3 devices`)
+	}
+
+	if secure, err := alpaca.FieldByPath("secure").Bool(); err != nil || !secure {
+		t.Fatalf(`Should return true, instead returned %v %v`, secure, err)
+	}
+
+	inspected, err := alpaca.FieldByPath("inspected").Time()
+	if err != nil || !inspected.Equal(time.Date(2019, 7, 1, 9, 15, 0, 0, time.UTC)) {
+		t.Fatalf(`Should return 2019-07-01 09:15:00 UTC, instead returned %v %v`, inspected, err)
+	}
+
+	if hazards := alpaca.FieldByPath("hazards").Strings(); len(hazards) != 2 || hazards[1] != "Theft" {
+		t.Fatalf(`Should return [Fire Theft], instead returned %v`, hazards)
+	}
+
+	visited := []string{}
+	alpaca.Walk(func(f *Field) error {
+		visited = append(visited, f.PathString)
+		if f.PathString == "list_of_electrical[0]" {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	if len(visited) != 6 || visited[5] != "list_of_electrical[0]" {
+		t.Fatalf(`Should stop walking at list_of_electrical[0], instead visited %v`, visited)
+	}
+}
+
+func TestMutateValues(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"inspector": {
+					"type": "string"
+				},
+				"site": {
+					"type": "object",
+					"properties": {
+						"name": {
+							"type": "string"
+						}
+					}
+				},
+				"devices": {
+					"type": "array",
+					"maxItems": 3,
+					"items": {
+						"type": "object",
+						"properties": {
+							"device": {
+								"type": "string"
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+	data := `{"devices":[{"device":"Kettel"},{"device":"Heater"}]}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestMutateValues error: %s", err)
+	}
+
+	if result := alpaca.Parse(); result != `{"devices":[{"device":"Kettel"},{"device":"Heater"}]}` {
+		t.Fatalf(`Should return {"devices":[{"device":"Kettel"},{"device":"Heater"}]}, instead returned %s`, result)
+	}
+
+	steps := []func() error{
+		func() error { return alpaca.SetValue("inspector", "INS-42") },
+		func() error { return alpaca.SetValue("site.name", "Methil") },
+		func() error { return alpaca.SetValue("devices[0].device", "Kettle") },
+		func() error { return alpaca.AppendItem("devices", map[string]string{"device": "Fridge"}) },
+		func() error { return alpaca.RemoveItem("devices", 1) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("TestMutateValues error: %s", err)
+		}
+	}
+
+	if result := alpaca.Parse(); result != `{"devices":[{"device":"Kettle"},{"device":"Fridge"}],"inspector":"INS-42","site":{"name":"Methil"}}` {
+		t.Fatalf(`Should return {"devices":[{"device":"Kettle"},{"device":"Fridge"}],"inspector":"INS-42","site":{"name":"Methil"}}, instead returned %s`, result)
+	}
+
+	fridge := alpaca.FieldByPath("devices[1].device")
+	if fridge == nil || fridge.String() != "Fridge" || fridge.Parent.ArrayIndex != 1 || fridge.Parent.Parent.ArrayValues != 2 {
+		t.Fatalf(`Should return Fridge as the second device, instead returned %v`, fridge)
+	}
+	if alpaca.FieldByPath("devices[2]") != nil {
+		t.Fatalf(`Should not return a third device`)
+	}
+
+	alpaca.AppendItem("devices", map[string]string{"device": "Oven"})
+	if err := alpaca.AppendItem("devices", map[string]string{"device": "Toaster"}); !errors.Is(err, ErrMaxItemsExceeded) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrMaxItemsExceeded, err)
+	}
+	if err := alpaca.RemoveItem("devices", 5); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrIndexOutOfRange, err)
+	}
+	if err := alpaca.SetValue("missing", "x"); !errors.Is(err, ErrFieldNotFound) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrFieldNotFound, err)
+	}
+	if err := alpaca.AppendItem("inspector", "x"); !errors.Is(err, ErrNotArray) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrNotArray, err)
+	}
+
+	// A change the form rejects leaves the data and fields as they were
+	strict, err := New(AlpacaOptions{Schema: schema, Data: data, AdditionalProperties: AdditionalPropertiesReject})
+	if err != nil {
+		t.Fatalf("TestMutateValues error: %s", err)
+	}
+	var additionalErr *AdditionalPropertiesError
+	if err := strict.SetValue("site", map[string]string{"name": "Methil", "postcode": "KY8 3RA"}); !errors.As(err, &additionalErr) {
+		t.Fatalf(`Should return an AdditionalPropertiesError, instead returned %v`, err)
+	}
+	if result := strict.Parse(); result != `{"devices":[{"device":"Kettel"},{"device":"Heater"}]}` {
+		t.Fatalf(`Should return {"devices":[{"device":"Kettel"},{"device":"Heater"}]}, instead returned %s`, result)
+	}
+	if strict.FieldByPath("devices[1].device") == nil || len(strict.AdditionalPaths) != 0 {
+		t.Fatalf(`Should keep the fields registered before the change, instead registered %d`, len(strict.FieldRegistry))
+	}
+}
+
+func TestFieldPointers(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site.name": {
+					"type": "string"
+				},
+				"a/b~c": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"it's [x]": {
+								"type": "string"
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+	data := `{"site.name":"Methil","a/b~c":[{"it's [x]":"first"},{"it's [x]":"second"}]}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestFieldPointers error: %s", err)
+	}
+
+	item := alpaca.FieldByPath("a/b~c[1].it's [x]")
+	if item.Pointer != "/a~1b~0c/1/it's [x]" || item.JSONPath != `$['a/b~c'][1]['it\'s [x]']` {
+		t.Fatalf(`Should return /a~1b~0c/1/it's [x] and $['a/b~c'][1]['it\'s [x]'], instead returned %s and %s`, item.Pointer, item.JSONPath)
+	}
+
+	for _, path := range []string{item.JSONPath, `$["a/b~c"][1]["it's [x]"]`} {
+		f, err := alpaca.FieldByJSONPath(path)
+		if err != nil || f != item {
+			t.Fatalf(`Should resolve %s to the second item, instead returned %v %v`, path, f, err)
+		}
+	}
+
+	f, err := alpaca.FieldByPointer(item.Pointer)
+	if err != nil || f != item {
+		t.Fatalf(`Should resolve %s to the second item, instead returned %v %v`, item.Pointer, f, err)
+	}
+
+	f, err = alpaca.FieldByJSONPath("$.site.name")
+	if !errors.Is(err, ErrFieldNotFound) {
+		t.Fatalf(`Should not resolve $.site.name, instead returned %v %v`, f, err)
+	}
+	if f, err := alpaca.FieldByPointer("/site.name"); err != nil || f.String() != "Methil" {
+		t.Fatalf(`Should resolve /site.name to Methil, instead returned %v %v`, f, err)
+	}
+
+	if _, err := alpaca.FieldByPointer("site"); !errors.Is(err, ErrPathInvalid) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrPathInvalid, err)
+	}
+	if _, err := alpaca.FieldByJSONPath("$['site"); !errors.Is(err, ErrPathInvalid) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrPathInvalid, err)
+	}
+}
+
+func TestFieldIDs(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"type": "string"
+				},
+				"devices": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"name": {
+								"type": "string"
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	ids := func(options AlpacaOptions) map[string]string {
+		alpaca, err := New(options)
+		if err != nil {
+			t.Fatalf("TestFieldIDs error: %s", err)
+		}
+		result := map[string]string{}
+		seen := map[string]bool{}
+		for _, f := range alpaca.FieldRegistry {
+			if f.ID == "" || seen[f.ID] {
+				t.Fatalf(`Should return a unique ID for %s, instead returned %s`, f.PathString, f.ID)
+			}
+			seen[f.ID] = true
+			if f.Key == "name" {
+				result[f.String()] = f.ID
+			} else {
+				result[f.PathString] = f.ID
+			}
+		}
+		return result
+	}
+
+	keyed := strings.Replace(schema, `"schema": {`, `"options": {"fields": {"devices": {"itemKey": "name"}}}, "schema": {`, 1)
+	before := ids(AlpacaOptions{Schema: keyed, Data: `{"site":"Methil","devices":[{"name":"Kettle"},{"name":"Toaster"}]}`})
+	after := ids(AlpacaOptions{Schema: keyed, Data: `{"site":"Leven","devices":[{"name":"Toaster"},{"name":"Kettle"}]}`})
+	for _, key := range []string{"site", "devices", "Kettle", "Toaster"} {
+		if before[key] != after[key] {
+			t.Fatalf(`Should keep the ID of %s when items are reordered, instead returned %s and %s`, key, before[key], after[key])
+		}
+	}
+
+	sequential := ids(AlpacaOptions{Schema: schema, Data: `{"site":"Methil"}`, IDStrategy: IDStrategySequential})
+	if sequential[""] != "alpaca1" || sequential["site"] != "alpaca2" {
+		t.Fatalf(`Should return alpaca1 and alpaca2, instead returned %s and %s`, sequential[""], sequential["site"])
+	}
+
+	duplicates := ids(AlpacaOptions{Schema: keyed, Data: `{"devices":[{"name":"Kettle"},{"name":"Kettle"}]}`})
+	if len(duplicates) != 6 {
+		t.Fatalf(`Should return 6 fields, instead returned %d`, len(duplicates))
+	}
+
+	// Items without an itemKey are identified by their position, never by their answers
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: `{"devices":[{"name":"Kettle"},{"name":"Kettle"}]}`})
+	if err != nil {
+		t.Fatalf("TestFieldIDs error: %s", err)
+	}
+	item := alpaca.FieldByPath("devices[1]").ID
+	name := alpaca.FieldByPath("devices[1].name").ID
+	if strings.Contains(item+name, "-") {
+		t.Fatalf(`Should not number the IDs of identical items, instead returned %s and %s`, item, name)
+	}
+	if err := alpaca.SetValue("devices[1].name", "Toaster"); err != nil {
+		t.Fatalf("TestFieldIDs error: %s", err)
+	}
+	if f := alpaca.FieldByPath("devices[1].name"); f.ID != name || f.Parent.ID != item {
+		t.Fatalf(`Should keep the IDs %s and %s when an answer is edited, instead returned %s and %s`, name, item, f.ID, f.Parent.ID)
+	}
+
+	_, err = New(AlpacaOptions{Schema: `{"schema":{"type":"array","enum":["a"]},"options":{"optionLabels":"a"}}`, Data: `["a"]`})
+	var fieldError *FieldError
+	if !errors.As(err, &fieldError) || fieldError.ID == "" {
+		t.Fatalf(`Should return a field error with an ID, instead returned %v`, err)
+	}
+}
+
+func TestProtectFields(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"form_ref": {
+					"type": "string",
+					"readonly": true,
+					"default": "F-100"
+				},
+				"site": {
+					"type": "string"
+				},
+				"user_id": {
+					"type": "string"
+				},
+				"tracking": {
+					"type": "string"
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"user_id": {
+					"type": "hidden"
+				},
+				"tracking": {
+					"type": "hidden"
+				}
+			}
+		}
+	}`
+	data := `{"form_ref":"F-999","site":"Methil","user_id":"admin","tracking":"x"}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestProtectFields error: %s", err)
+	}
+	result := alpaca.Parse()
+	if result != `{"form_ref":"F-999","site":"Methil","tracking":"x","user_id":"admin"}` {
+		t.Fatalf(`Should return submitted values without protection, instead returned %s`, result)
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: schema, Data: data, Protect: true, ServerValues: map[string]interface{}{"/user_id": "u-42"}})
+	if err != nil {
+		t.Fatalf("TestProtectFields error: %s", err)
+	}
+	result = alpaca.Parse()
+	if result != `{"form_ref":"F-100","site":"Methil","user_id":"u-42"}` {
+		t.Fatalf(`Should return {"form_ref":"F-100","site":"Methil","user_id":"u-42"}, instead returned %s`, result)
+	}
+	if len(alpaca.TamperEvents) != 3 || alpaca.TamperEvents[0].Path != "form_ref" || alpaca.TamperEvents[0].Type != "readonly" || alpaca.TamperEvents[0].Submitted != "F-999" {
+		t.Fatalf(`Should return 3 tamper events starting with form_ref, instead returned %v`, alpaca.TamperEvents)
+	}
+
+	if err := alpaca.SetValue("form_ref", "F-200"); err != nil {
+		t.Fatalf("TestProtectFields error: %s", err)
+	}
+	if value := alpaca.FieldByPath("form_ref").String(); value != "F-200" || len(alpaca.TamperEvents) != 3 {
+		t.Fatalf(`Should keep server set value F-200 without new tamper events, instead returned %s %v`, value, alpaca.TamperEvents)
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: schema, Data: `{"site":"Methil"}`, Protect: true})
+	if err != nil {
+		t.Fatalf("TestProtectFields error: %s", err)
+	}
+	if result := alpaca.Parse(); result != `{"form_ref":"F-100","site":"Methil"}` || len(alpaca.TamperEvents) != 0 {
+		t.Fatalf(`Should return {"form_ref":"F-100","site":"Methil"} without tamper events, instead returned %s %v`, result, alpaca.TamperEvents)
+	}
+
+	// Server values follow their items when an earlier item is removed
+	devices := `{"schema":{"type":"object","properties":{"devices":{"type":"array","maxItems":5,"items":{"type":"object","properties":{"name":{"type":"string"},"serial":{"type":"string","readonly":true}}}}}}}`
+	alpaca, err = New(AlpacaOptions{Schema: devices, Data: `{"devices":[{"name":"Kettle"},{"name":"Fridge"},{"name":"Oven"}]}`, Protect: true})
+	if err != nil {
+		t.Fatalf("TestProtectFields error: %s", err)
+	}
+	for i, serial := range []string{"K-1", "F-2", "O-3"} {
+		if err := alpaca.SetValue("devices["+strconv.Itoa(i)+"].serial", serial); err != nil {
+			t.Fatalf("TestProtectFields error: %s", err)
+		}
+	}
+	if err := alpaca.RemoveItem("devices", 0); err != nil {
+		t.Fatalf("TestProtectFields error: %s", err)
+	}
+	result = alpaca.Parse()
+	if result != `{"devices":[{"name":"Fridge","serial":"F-2"},{"name":"Oven","serial":"O-3"}]}` || len(alpaca.TamperEvents) != 0 {
+		t.Fatalf(`Should return {"devices":[{"name":"Fridge","serial":"F-2"},{"name":"Oven","serial":"O-3"}]} without tamper events, instead returned %s %v`, result, alpaca.TamperEvents)
+	}
+}
+
+func TestAdditionalProperties(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"type": "string"
+				},
+				"devices": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"name": {
+								"type": "string"
+							}
+						}
+					}
+				},
+				"extra": {
+					"type": "object",
+					"additionalProperties": true
+				}
+			}
+		}
+	}`
+	data := `{"site":"Methil","is_admin":true,"devices":[{"name":"Kettle","price":0}],"extra":{"note":"kept"}}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestAdditionalProperties error: %s", err)
+	}
+	if result := alpaca.Parse(); result != `{"devices":[{"name":"Kettle"}],"extra":{"note":"kept"},"site":"Methil"}` {
+		t.Fatalf(`Should return {"devices":[{"name":"Kettle"}],"extra":{"note":"kept"},"site":"Methil"}, instead returned %s`, result)
+	}
+	if len(alpaca.AdditionalPaths) != 2 || alpaca.AdditionalPaths[0] != "devices[0].price" || alpaca.AdditionalPaths[1] != "is_admin" {
+		t.Fatalf(`Should return [devices[0].price is_admin], instead returned %v`, alpaca.AdditionalPaths)
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: schema, Data: data, AdditionalProperties: AdditionalPropertiesAllow})
+	if err != nil {
+		t.Fatalf("TestAdditionalProperties error: %s", err)
+	}
+	if result := alpaca.Parse(); result != `{"devices":[{"name":"Kettle","price":0}],"extra":{"note":"kept"},"is_admin":true,"site":"Methil"}` {
+		t.Fatalf(`Should return {"devices":[{"name":"Kettle","price":0}],"extra":{"note":"kept"},"is_admin":true,"site":"Methil"}, instead returned %s`, result)
+	}
+
+	_, err = New(AlpacaOptions{Schema: schema, Data: data, AdditionalProperties: AdditionalPropertiesReject})
+	var additionalError *AdditionalPropertiesError
+	if !errors.Is(err, ErrAdditionalProperties) || !errors.As(err, &additionalError) || len(additionalError.Paths) != 2 {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrAdditionalProperties, err)
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: `{"schema":{"type":"object"}}`, Data: `{"a":1}`, AdditionalProperties: AdditionalPropertiesAllow})
+	if err != nil {
+		t.Fatalf("TestAdditionalProperties error: %s", err)
+	}
+	if result := alpaca.Parse(); result != `{"a":1}` {
+		t.Fatalf(`Should return {"a":1}, instead returned %s`, result)
+	}
+
+	// Any fields and objects without properties are free-form, so nothing is stripped from them
+	free := `{"schema":{"type":"object","properties":{"meta":{"type":"any"},"notes":{"type":"object"},"closed":{"type":"object","additionalProperties":false}}}}`
+	alpaca, err = New(AlpacaOptions{Schema: free, Data: `{"meta":{"a":1,"b":[1,2]},"notes":{"x":"y"},"closed":{"z":1}}`})
+	if err != nil {
+		t.Fatalf("TestAdditionalProperties error: %s", err)
+	}
+	if result := alpaca.Parse(); result != `{"meta":{"a":1,"b":[1,2]},"notes":{"x":"y"}}` {
+		t.Fatalf(`Should return {"meta":{"a":1,"b":[1,2]},"notes":{"x":"y"}}, instead returned %s`, result)
+	}
+	if len(alpaca.AdditionalPaths) != 1 || alpaca.AdditionalPaths[0] != "closed.z" {
+		t.Fatalf(`Should return [closed.z], instead returned %v`, alpaca.AdditionalPaths)
+	}
+}
+
+func TestEmptyPolicy(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"type": "string"
+				},
+				"notes": {
+					"type": "string"
+				},
+				"count": {
+					"type": "number"
+				},
+				"devices": {
+					"type": "array",
+					"items": {
+						"type": "string"
+					}
+				},
+				"address": {
+					"type": "object",
+					"properties": {
+						"street": {
+							"type": "string"
+						}
+					}
+				},
+				"reference": {
+					"type": "string"
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"reference": {
+					"emptyValue": "null"
+				}
+			}
+		}
+	}`
+	data := `{"site":"Methil","notes":"","count":null,"devices":[],"address":{},"reference":""}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestEmptyPolicy error: %s", err)
+	}
+
+	expected := map[EmptyPolicy]string{
+		EmptyOmit:   `{"reference":null,"site":"Methil"}`,
+		EmptyNull:   `{"address":null,"count":null,"devices":null,"notes":null,"reference":null,"site":"Methil"}`,
+		EmptyString: `{"address":"","count":"","devices":"","notes":"","reference":null,"site":"Methil"}`,
+	}
+	for policy, want := range expected {
+		result, err := alpaca.ParseWith(ParseOptions{Empty: policy})
+		if err != nil || result != want {
+			t.Fatalf(`Should return %s, instead returned %s %v`, want, result, err)
+		}
+	}
+
+	alpaca, err = New(AlpacaOptions{Schema: `{"schema":{"type":"string"}}`, Data: `""`})
+	if err != nil {
+		t.Fatalf("TestEmptyPolicy error: %s", err)
+	}
+	if result, _ := alpaca.ParseWith(ParseOptions{Empty: EmptyNull}); result != "null" {
+		t.Fatalf(`Should return null, instead returned %s`, result)
+	}
+
+	// Checkboxes submitted empty follow the policy too, unticked ones are answers
+	checkboxes := `{"schema":{"type":"object","properties":{"agree":{"type":"boolean"},"hazards":{"type":"array","items":{"type":"string","enum":["Fire","Flood"]}},"signed":{"type":"boolean"}}},"options":{"fields":{"agree":{"type":"checkbox"},"hazards":{"type":"checkbox","emptyValue":"string"},"signed":{"type":"checkbox"}}}}`
+	alpaca, err = New(AlpacaOptions{Schema: checkboxes, Data: `{"agree":"","hazards":[],"signed":false}`})
+	if err != nil {
+		t.Fatalf("TestEmptyPolicy error: %s", err)
+	}
+	expected = map[EmptyPolicy]string{
+		EmptyOmit: `{"hazards":"","signed":false}`,
+		EmptyNull: `{"agree":null,"hazards":"","signed":false}`,
+	}
+	for policy, want := range expected {
+		result, err := alpaca.ParseWith(ParseOptions{Empty: policy})
+		if err != nil || result != want {
+			t.Fatalf(`Should return %s, instead returned %s %v`, want, result, err)
+		}
+	}
+
+	// Unanswered checkboxes were left unticked, so they follow the policy rather than being written as {}
+	alpaca, err = New(AlpacaOptions{Schema: checkboxes, Data: `{}`})
+	if err != nil {
+		t.Fatalf("TestEmptyPolicy error: %s", err)
+	}
+	expected = map[EmptyPolicy]string{
+		EmptyOmit:   `{"hazards":""}`,
+		EmptyNull:   `{"agree":null,"hazards":"","signed":null}`,
+		EmptyString: `{"agree":"","hazards":"","signed":""}`,
+	}
+	for policy, want := range expected {
+		result, err := alpaca.ParseWith(ParseOptions{Empty: policy})
+		if err != nil || result != want {
+			t.Fatalf(`Should return %s, instead returned %s %v`, want, result, err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	schema := `{
+		"schema": {
+			"title": "Inspection",
+			"type": "object",
+			"properties": {
+				"intro": {
+					"type": "information"
+				},
+				"site": {
+					"title": "Site",
+					"type": "object",
+					"properties": {
+						"name": {
+							"title": "Name",
+							"type": "string"
+						},
+						"risk": {
+							"title": "Risk",
+							"type": "string",
+							"enum": ["h", "l"]
+						}
+					}
+				},
+				"devices": {
+					"title": "Devices",
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"name": {
+								"title": "Device",
+								"type": "string"
+							},
+							"passed": {
+								"title": "Passed",
+								"type": "boolean"
+							}
+						}
+					}
+				},
+				"signature": {
+					"title": "Signature",
+					"type": "string"
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"intro": {
+					"type": "information"
+				},
+				"site": {
+					"fields": {
+						"risk": {
+							"optionLabels": ["High", "Low"]
+						}
+					}
+				},
+				"signature": {
+					"type": "signature"
+				}
+			}
+		}
+	}`
+	data := `{"site":{"name":"<Methil>","risk":"h"},"devices":[{"name":"Kettle","passed":true}],"signature":"data:image/png;base64,iVBORw0KGgo="}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestRender error: %s", err)
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := alpaca.Render(buffer, RenderOptions{}); err != nil {
+		t.Fatalf("TestRender error: %s", err)
+	}
+	result := buffer.String()
+	for _, want := range []string{
+		`<h1>Inspection</h1>`,
+		`<h2>Site</h2>`,
+		`&lt;Methil&gt;`,
+		`<span class="alpaca-value">High</span>`,
+		`<th>Device</th><th>Passed</th>`,
+		`<td><div class="alpaca-field alpaca-text" id="` + alpaca.FieldByPath("devices[0].name").ID + `"><span class="alpaca-value">Kettle</span></div></td>`,
+		`<img class="alpaca-image" src="data:image/png;base64,iVBORw0KGgo="`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Fatalf(`Should contain %s, instead returned %s`, want, result)
+		}
+	}
+	if strings.Contains(result, "alpaca-information") {
+		t.Fatalf(`Should skip information fields, instead returned %s`, result)
+	}
+
+	buffer.Reset()
+	override := template.Must(template.New("signature").Parse(`<p class="signed">{{.Title}}</p>`))
+	if err := alpaca.Render(buffer, RenderOptions{Templates: map[string]*template.Template{"signature": override}, Raw: true}); err != nil {
+		t.Fatalf("TestRender error: %s", err)
+	}
+	if result := buffer.String(); !strings.Contains(result, `<p class="signed">Signature</p>`) || !strings.Contains(result, `<span class="alpaca-value">h</span>`) {
+		t.Fatalf(`Should use the signature override and raw values, instead returned %s`, result)
+	}
+
+	// Only PNG, JPEG and GIF answers are shown as images, SVG can carry script
+	svg := "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(`<svg onload="alert(1)"/>`))
+	if err := alpaca.SetValue("signature", svg); err != nil {
+		t.Fatalf("TestRender error: %s", err)
+	}
+	buffer.Reset()
+	if err := alpaca.Render(buffer, RenderOptions{}); err != nil {
+		t.Fatalf("TestRender error: %s", err)
+	}
+	if result := buffer.String(); strings.Contains(result, `<img class="alpaca-image"`) || !strings.Contains(result, `<span class="alpaca-value">data:image/svg&#43;xml;base64,`) {
+		t.Fatalf(`Should render the SVG answer as text, instead returned %s`, result)
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	schema := `{
+		"schema": {
+			"title": "Inspection",
+			"type": "object",
+			"properties": {
+				"site": {
+					"title": "Site (main)",
+					"type": "string"
+				},
+				"notes": {
+					"title": "Notes",
+					"type": "string"
+				},
+				"devices": {
+					"title": "Devices",
+					"type": "array",
+					"items": {
+						"title": "Device",
+						"type": "object",
+						"properties": {
+							"name": {
+								"title": "Name",
+								"type": "string"
+							}
+						}
+					}
+				},
+				"signature": {
+					"title": "Signed",
+					"type": "string"
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"signature": {
+					"type": "signature"
+				}
+			}
+		}
+	}`
+
+	signature := new(bytes.Buffer)
+	png.Encode(signature, image.NewNRGBA(image.Rect(0, 0, 20, 10)))
+	photo := new(bytes.Buffer)
+	jpeg.Encode(photo, image.NewRGBA(image.Rect(0, 0, 40, 30)), nil)
+
+	data := map[string]interface{}{
+		"site":      "Methil",
+		"notes":     strings.Repeat("A long note that wraps over many lines. ", 400),
+		"devices":   []interface{}{map[string]interface{}{"name": "Kettle"}},
+		"signature": "data:image/png;base64," + base64.StdEncoding.EncodeToString(signature.Bytes()),
+	}
+	encoded, _ := json.Marshal(data)
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: string(encoded)})
+	if err != nil {
+		t.Fatalf("TestRenderPDF error: %s", err)
+	}
+	site := alpaca.FieldByPath("site")
+	site.Media = append(site.Media, ImageFile{Data: hex.EncodeToString(photo.Bytes()), Name: "site_image_0"})
+
+	buffer := new(bytes.Buffer)
+	if err := alpaca.RenderPDF(buffer, PDFOptions{Header: "Inspection {ref}", FormRef: "F-100"}); err != nil {
+		t.Fatalf("TestRenderPDF error: %s", err)
+	}
+	result := buffer.String()
+
+	for _, want := range []string{"%PDF-1.4", "(Site \\(main\\)) Tj", "(Device 1) Tj", "(Kettle) Tj", "(Signed) Tj", "(Inspection F-100) Tj", "/Filter /DCTDecode", "/Filter /FlateDecode"} {
+		if !strings.Contains(result, want) {
+			t.Fatalf(`Should contain %s, instead returned %s`, want, result)
+		}
+	}
+
+	pages := strings.Count(result, "/Type /Page ")
+	if pages < 2 || !strings.Contains(result, fmt.Sprintf("(Page %d of %d) Tj", pages, pages)) {
+		t.Fatalf(`Should number %d pages, instead returned %s`, pages, result)
+	}
+
+	// The notes run over several pages without being drawn into the bottom margin
+	for _, line := range strings.Split(result, "\n") {
+		var font, x, y float64
+		if n, _ := fmt.Sscanf(line, "BT /F%g 10.00 Tf %g %g Td", &font, &x, &y); n == 3 && y < 50 {
+			t.Fatalf(`Should keep answers above the bottom margin, instead drew %s`, line)
+		}
+	}
+
+	// Every cross reference entry must point at its object
+	xref := strings.LastIndex(result, "\nxref\n") + 1
+	entries := strings.Split(result[xref:], "\n")[3:]
+	for i := 1; strings.HasSuffix(entries[i-1], " n "); i++ {
+		offset, _ := strconv.Atoi(entries[i-1][:10])
+		if !strings.HasPrefix(result[offset:], strconv.Itoa(i)+" 0 obj") {
+			t.Fatalf(`Should point object %d at its offset, instead found %.20s`, i, result[offset:])
+		}
+	}
+
+	// Images with more pixels than allowed are left out rather than decoded
+	buffer.Reset()
+	if err := alpaca.RenderPDF(buffer, PDFOptions{MaxImagePixels: 100}); err != nil {
+		t.Fatalf("TestRenderPDF error: %s", err)
+	}
+	if result := buffer.String(); strings.Contains(result, "/Filter /FlateDecode") || !strings.Contains(result, "/Filter /DCTDecode") {
+		t.Fatalf(`Should leave out the 200 pixel signature, instead returned %s`, result)
+	}
+}
+
+func TestCSVExport(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"type": "string"
+				},
+				"risk": {
+					"type": "string",
+					"enum": ["h", "l"]
+				},
+				"devices": {
+					"type": "array",
+					"maxItems": 2,
+					"items": {
+						"type": "object",
+						"properties": {
+							"name": {
+								"type": "string"
+							},
+							"passed": {
+								"type": "boolean"
+							}
+						}
+					}
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"risk": {
+					"optionLabels": ["High", "Low"]
+				}
+			}
+		}
+	}`
+
+	submissions := []Submission{}
+	for id, data := range []string{
+		`{"site":"Methil, Fife","risk":"h","devices":[{"name":"Kettle","passed":true},{"name":"Toaster","passed":false}]}`,
+		`{"site":"Leven","devices":[{"name":"Lamp"}]}`,
+	} {
+		form, err := New(AlpacaOptions{Schema: schema, Data: data})
+		if err != nil {
+			t.Fatalf("TestCSVExport error: %s", err)
+		}
+		submissions = append(submissions, Submission{ID: strconv.Itoa(id + 1), Form: form})
+	}
+
+	exporter, err := NewCSVExporter(schema, CSVOptions{MaxItems: 5, Labels: true})
+	if err != nil {
+		t.Fatalf("TestCSVExport error: %s", err)
+	}
+	buffer := new(bytes.Buffer)
+	if err := exporter.Write(buffer, submissions); err != nil {
+		t.Fatalf("TestCSVExport error: %s", err)
+	}
+	expected := "submission_id,site,risk,devices[0].name,devices[0].passed,devices[1].name,devices[1].passed\n" +
+		"1,\"Methil, Fife\",High,Kettle,Yes,Toaster,No\n" +
+		"2,Leven,,Lamp,,,\n"
+	if result := buffer.String(); result != expected {
+		t.Fatalf(`Should return %s, instead returned %s`, expected, result)
+	}
+
+	exporter, err = NewCSVExporter(schema, CSVOptions{ChildTables: true})
+	if err != nil {
+		t.Fatalf("TestCSVExport error: %s", err)
+	}
+	tables := exporter.Tables(submissions)
+	if len(tables) != 2 || tables[1].Name != "devices" {
+		t.Fatalf(`Should return a main table and a devices table, instead returned %v`, tables)
+	}
+	buffer.Reset()
+	if err := tables[1].Write(buffer); err != nil {
+		t.Fatalf("TestCSVExport error: %s", err)
+	}
+	expected = "submission_id,parent,index,name,passed\n1,devices,0,Kettle,true\n1,devices,1,Toaster,false\n2,devices,0,Lamp,\n"
+	if result := buffer.String(); result != expected || strings.Join(tables[0].Columns, ",") != "submission_id,site,risk" {
+		t.Fatalf(`Should return %s, instead returned %s %v`, expected, result, tables[0].Columns)
+	}
+}
+
+func TestLongExport(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"title": "Site",
+					"type": "string"
+				},
+				"devices": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"passed": {
+								"title": "Passed",
+								"type": "boolean"
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+	form, err := New(AlpacaOptions{Schema: schema, Data: `{"site":"Methil","devices":[{"passed":true},{"passed":false}]}`})
+	if err != nil {
+		t.Fatalf("TestLongExport error: %s", err)
+	}
+	submissions := []Submission{{ID: "s1", Form: form}}
+
+	buffer := new(bytes.Buffer)
+	if err := WriteNDJSON(buffer, submissions); err != nil {
+		t.Fatalf("TestLongExport error: %s", err)
+	}
+	expected := `{"submission_id":"s1","path":"site","schema_path":"site","title":"Site","type":"text","value":"Methil","label":"Methil","array_index":null}` + "\n" +
+		`{"submission_id":"s1","path":"devices[0].passed","schema_path":"devices[].passed","title":"Passed","type":"checkbox","value":true,"label":"Yes","array_index":0}` + "\n" +
+		`{"submission_id":"s1","path":"devices[1].passed","schema_path":"devices[].passed","title":"Passed","type":"checkbox","value":false,"label":"No","array_index":1}` + "\n"
+	if result := buffer.String(); result != expected {
+		t.Fatalf(`Should return %s, instead returned %s`, expected, result)
+	}
+
+	buffer.Reset()
+	if err := WriteLongCSV(buffer, submissions); err != nil {
+		t.Fatalf("TestLongExport error: %s", err)
+	}
+	expected = "submission_id,path,schema_path,title,type,value,label,array_index\n" +
+		"s1,site,site,Site,text,Methil,Methil,\n" +
+		"s1,devices[0].passed,devices[].passed,Passed,checkbox,true,Yes,0\n" +
+		"s1,devices[1].passed,devices[].passed,Passed,checkbox,false,No,1\n"
+	if result := buffer.String(); result != expected {
+		t.Fatalf(`Should return %s, instead returned %s`, expected, result)
+	}
+}
+
+func TestXLSXExport(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"title": "Site",
+					"type": "string"
+				},
+				"visited": {
+					"title": "Visited",
+					"type": "string",
+					"format": "date"
+				},
+				"devices": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"watts": {
+								"title": "Watts",
+								"type": "number"
+							},
+							"photo": {
+								"title": "Photo",
+								"type": "string"
+							}
+						}
+					}
+				}
+			}
+		}
+	}`
+	form, err := New(AlpacaOptions{Schema: schema, Data: `{"site":"Fish & Chips","visited":"2019-03-25","devices":[{"watts":1500}]}`})
+	if err != nil {
+		t.Fatalf("TestXLSXExport error: %s", err)
+	}
+	photo := form.FieldByPath("devices[0].photo")
+	photo.Media = append(photo.Media, ImageFile{Name: "devices[0].photo_image_0"})
+
+	exporter, err := NewXLSXExporter(schema, XLSXOptions{MediaURL: func(file ImageFile) string { return "https://example.com/" + file.Name }})
+	if err != nil {
+		t.Fatalf("TestXLSXExport error: %s", err)
+	}
+	buffer := new(bytes.Buffer)
+	if err := exporter.Write(buffer, []Submission{{ID: "s1", Form: form}}); err != nil {
+		t.Fatalf("TestXLSXExport error: %s", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("TestXLSXExport error: %s", err)
+	}
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		contents, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		parts[file.Name] = string(contents)
+
+		decoder := xml.NewDecoder(bytes.NewReader(contents))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf(`Should write well formed XML in %s, instead returned %s`, file.Name, err)
+			}
+		}
+	}
+
+	for part, wants := range map[string][]string{
+		"xl/workbook.xml": {`<sheet name="Answers" sheetId="1" r:id="rId1"/>`, `<sheet name="devices" sheetId="2" r:id="rId2"/>`},
+		"xl/worksheets/sheet1.xml": {
+			`<c r="B1" s="1" t="inlineStr"><is><t xml:space="preserve">Site</t></is></c>`,
+			`<c r="B2" t="inlineStr"><is><t xml:space="preserve">Fish &amp; Chips</t></is></c>`,
+			`<c r="C2" s="2"><v>43549</v></c>`,
+		},
+		"xl/worksheets/sheet2.xml": {
+			`<c r="D1" s="1" t="inlineStr"><is><t xml:space="preserve">Watts</t></is></c>`,
+			`<c r="C2"><v>0</v></c>`,
+			`<c r="D2"><v>1500</v></c>`,
+			`<c r="E2" t="str"><f>HYPERLINK(&#34;https://example.com/devices[0].photo_image_0&#34;,&#34;devices[0].photo_image_0&#34;)</f>`,
+		},
+	} {
+		for _, want := range wants {
+			if !strings.Contains(parts[part], want) {
+				t.Fatalf(`Should contain %s in %s, instead returned %s`, want, part, parts[part])
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"properties": {
+				"site": {
+					"type": "string"
+				},
+				"visited": {
+					"type": "string",
+					"format": "date"
+				},
+				"hazards": {
+					"type": "array",
+					"items": {
+						"type": "string",
+						"enum": ["Fire", "Flood"]
+					}
+				},
+				"photos": {
+					"type": "string"
+				},
+				"list_of_electrical": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"electrical_device": {
+								"type": "string"
+							},
+							"watts": {
+								"type": "number"
+							}
+						}
+					}
+				}
+			}
+		},
+		"options": {
+			"fields": {
+				"hazards": {
+					"type": "checkbox"
+				},
+				"photos": {
+					"type": "camera"
+				}
+			}
+		}
+	}`
+	data := `{"site":"Methil","visited":"2019-03-25","hazards":["Fire","Flood"],"list_of_electrical":[{"electrical_device":"Kettle","watts":"1500"},{"electrical_device":"Lamp"}]}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data})
+	if err != nil {
+		t.Fatalf("TestDecode error: %s", err)
+	}
+	photos := alpaca.FieldByPath("photos")
+	photos.Media = append(photos.Media, ImageFile{Name: "photos_image_0"})
+
+	type Device struct {
+		Name  string   `alpaca:"electrical_device"`
+		Watts *float64 `alpaca:"watts"`
+	}
+	var form struct {
+		Site    string    `alpaca:"site"`
+		Visited time.Time `alpaca:"visited"`
+		Hazards []string  `alpaca:"hazards"`
+		Photos  Media     `alpaca:"photos"`
+		Devices []Device  `alpaca:"list_of_electrical"`
+		Names   []string  `alpaca:"list_of_electrical[].electrical_device"`
+		Missing string    `alpaca:"missing"`
+		Ignored string
+	}
+	if err := Decode(alpaca, &form); err != nil {
+		t.Fatalf("TestDecode error: %s", err)
+	}
+
+	if form.Site != "Methil" || !form.Visited.Equal(time.Date(2019, 3, 25, 0, 0, 0, 0, time.UTC)) || len(form.Hazards) != 2 || form.Hazards[1] != "Flood" {
+		t.Fatalf(`Should decode site, visited and hazards, instead returned %v`, form)
+	}
+	if len(form.Photos) != 1 || form.Photos[0].Name != "photos_image_0" {
+		t.Fatalf(`Should decode the photo, instead returned %v`, form.Photos)
+	}
+	if len(form.Devices) != 2 || form.Devices[0].Name != "Kettle" || *form.Devices[0].Watts != 1500 || form.Devices[1].Watts != nil {
+		t.Fatalf(`Should decode two devices, instead returned %v`, form.Devices)
+	}
+	if strings.Join(form.Names, ",") != "Kettle,Lamp" {
+		t.Fatalf(`Should decode Kettle,Lamp, instead returned %v`, form.Names)
+	}
+
+	var mismatch struct {
+		Site int `alpaca:"site"`
+	}
+	err = Decode(alpaca, &mismatch)
+	var decodeError *DecodeError
+	if !errors.Is(err, ErrDecodeType) || !errors.As(err, &decodeError) || decodeError.Path != "site" || decodeError.Field != "Site" {
+		t.Fatalf(`Should return %s for site, instead returned %v`, ErrDecodeType, err)
+	}
+
+	if err := Decode(alpaca, form); !errors.Is(err, ErrDecodeTarget) {
+		t.Fatalf(`Should return %s, instead returned %v`, ErrDecodeTarget, err)
+	}
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	type Device struct {
+		Name  string  `alpaca:"electrical_device,required" title:"Device"`
+		Watts float64 `alpaca:"watts" title:"Watts"`
+	}
+	type Inspection struct {
+		Site     string    `alpaca:"site,required" title:"Site" order:"1"`
+		Visited  time.Time `alpaca:"visited" title:"Visited" format:"date"`
+		Location string    `alpaca:"location" title:"Location" enum:"External|Internal" optionLabels:"Outside|Inside" type:"radio" order:"3"`
+		Rating   int       `alpaca:"rating" enum:"1|2|3"`
+		Hazards  []string  `alpaca:"hazards" enum:"Fire|Flood"`
+		Photos   Media     `alpaca:"photos" title:"Photos"`
+		Devices  []Device  `alpaca:"list_of_electrical" title:"Devices" maxItems:"10"`
+		Ignored  string
+	}
+
+	schema, options, err := SchemaFromStruct(Inspection{})
+	if err != nil {
+		t.Fatalf("TestSchemaFromStruct error: %s", err)
+	}
+	expected := `{"type":"object","properties":{"site":{"title":"Site","type":"string","required":true},"visited":{"title":"Visited","type":"string","format":"date"},"location":{"title":"Location","type":"string","enum":["External","Internal"]},"rating":{"type":"integer","enum":[1,2,3]},"hazards":{"type":"array","items":{"type":"string","enum":["Fire","Flood"]}},"photos":{"title":"Photos","type":"string"},"list_of_electrical":{"title":"Devices","type":"array","items":{"type":"object","properties":{"electrical_device":{"title":"Device","type":"string","required":true},"watts":{"title":"Watts","type":"number"}}},"maxItems":10}}}`
+	if string(schema) != expected {
+		t.Fatalf(`Should return %s, instead returned %s`, expected, schema)
+	}
+	expected = `{"fields":{"site":{"order":1},"location":{"optionLabels":["Outside","Inside"],"type":"radio","order":3},"hazards":{"type":"checkbox"},"photos":{"type":"camera"}}}`
+	if string(options) != expected {
+		t.Fatalf(`Should return %s, instead returned %s`, expected, options)
+	}
+
+	data := `{"site":"Methil","visited":"2019-03-25","location":"Internal","rating":2,"hazards":["Flood"],"list_of_electrical":[{"electrical_device":"Kettle","watts":1500},{"electrical_device":"Heater","watts":2000},{"electrical_device":"Lamp","watts":60}]}`
+	alpaca, err := New(AlpacaOptions{Schema: `{"schema":` + string(schema) + `,"options":` + string(options) + `}`, Data: data})
+	if err != nil {
+		t.Fatalf("TestSchemaFromStruct error: %s", err)
+	}
+	if result := alpaca.FieldByPath("location"); result == nil || result.Type != "radio" || result.EnumLabel != "Inside" {
+		t.Fatalf(`Should return radio field labelled Inside, instead returned %v`, result)
+	}
+
+	var form Inspection
+	if err := Decode(alpaca, &form); err != nil {
+		t.Fatalf("TestSchemaFromStruct error: %s", err)
+	}
+	if form.Site != "Methil" || form.Location != "Internal" || form.Rating != 2 || len(form.Hazards) != 1 || len(form.Devices) != 3 || form.Devices[0].Watts != 1500 || form.Devices[2].Name != "Lamp" {
+		t.Fatalf(`Should decode submission into struct, instead returned %v`, form)
+	}
+
+	type Node struct {
+		Children []Node `alpaca:"children"`
+	}
+	if _, _, err := SchemaFromStruct(Node{}); !errors.Is(err, ErrStructRecursive) {
+		t.Fatalf(`Should return ErrStructRecursive, instead returned %v`, err)
+	}
+	type Invalid struct {
+		Path string `alpaca:"list[].name"`
+	}
+	if _, _, err := SchemaFromStruct(&Invalid{}); !errors.Is(err, ErrStructTagInvalid) {
+		t.Fatalf(`Should return ErrStructTagInvalid, instead returned %v`, err)
+	}
+	if _, _, err := SchemaFromStruct("string"); err != ErrStructInvalid {
+		t.Fatalf(`Should return ErrStructInvalid, instead returned %v`, err)
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	schema := `{"schema":{"type":"object","properties":{"site":{"type":"string","title":"Site"},"location":{"type":"string","title":"Location","enum":["External","Internal"]},"hazards":{"type":"array","items":{"type":"string","enum":["Fire","Flood"]}},"visited":{"type":"string","format":"date"},"photo":{"type":"string"},"list_of_electrical":{"type":"array","title":"Devices","maxItems":10,"items":{"type":"object","properties":{"electrical_device":{"type":"string"},"watts":{"type":"number"}}}}}},"options":{"fields":{"location":{"type":"radio","optionLabels":["Outside","Inside"]},"hazards":{"type":"checkbox"},"photo":{"type":"camera"},"list_of_electrical":{"type":"repeatable"}}}}`
+
+	source, err := GenerateGo(schema, GenerateOptions{Package: "forms", Type: "Inspection"})
+	if err != nil {
+		t.Fatalf("TestGenerateGo error: %s", err)
+	}
+	result := string(source)
+	for _, expected := range []string{
+		"// Code generated by alpaca-gen. DO NOT EDIT.\n\npackage forms\n",
+		"\tLocation         InspectionLocation           `alpaca:\"location\"`\n",
+		"\tHazards          []InspectionHazards          `alpaca:\"hazards\"`\n",
+		"\tVisited          time.Time                    `alpaca:\"visited\"`\n",
+		"\tPhoto            alpaca.Media                 `alpaca:\"photo\"`\n",
+		"\tListOfElectrical []InspectionListOfElectrical `alpaca:\"list_of_electrical\" maxItems:\"10\"`\n",
+		"\tWatts            float64 `alpaca:\"watts\"`\n",
+		"\tInspectionLocationExternal InspectionLocation = \"External\"\n",
+		"\tcase InspectionLocationInternal:\n\t\treturn \"Inside\"\n",
+		"func (f InspectionFields) ListOfElectricalItem(i int) InspectionListOfElectricalFields {\n",
+		"func (f InspectionFields) Decode() (Inspection, error) {\n",
+	} {
+		if !strings.Contains(result, expected) {
+			t.Fatalf(`Should contain %q, instead returned %s`, expected, result)
+		}
+	}
+
+	// The generated source must compile, even when properties are named like the generated methods and types
+	clashing := `{"schema":{"type":"object","properties":{"decode":{"type":"string"},"form":{"type":"string"},"path":{"type":"object","properties":{"form":{"type":"string"}}},"devices_item":{"type":"string"},"devices":{"type":"array","maxItems":5,"items":{"type":"object","properties":{"path":{"type":"string"}}}},"a_fields":{"type":"string","enum":["x"]},"a":{"type":"object","properties":{"b":{"type":"string"}}}}}}`
+	for _, form := range []string{schema, clashing} {
+		source, err := GenerateGo(form, GenerateOptions{Package: "forms", Type: "Inspection"})
+		if err != nil {
+			t.Fatalf("TestGenerateGo error: %s", err)
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "inspection_alpaca.go", source, 0)
+		if err != nil {
+			t.Fatalf("TestGenerateGo error: %s", err)
+		}
+		config := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+		if _, err := config.Check("forms", fset, []*ast.File{file}, nil); err != nil {
+			t.Fatalf(`Should generate source that compiles, instead returned %s in %s`, err, source)
+		}
+	}
+
+	// $refs to other documents are loaded, keys beside a $ref shaping the placeholder data
+	loader := FSRefLoader(fstest.MapFS{
+		"common.json": {Data: []byte(`{"definitions":{"meters":{"type":"array","title":"Meters","maxItems":4}}}`)},
+	})
+	refs := `{"schema":{"type":"object","properties":{"meters":{"$ref":"common.json#/definitions/meters","items":{"type":"object","properties":{"reading":{"type":"number"}}}}}}}`
+	if _, err := GenerateGo(refs, GenerateOptions{Package: "forms", Type: "Inspection"}); !errors.Is(err, ErrRefLoaderMissing) {
+		t.Fatalf(`Should return ErrRefLoaderMissing, instead returned %v`, err)
+	}
+	source, err = GenerateGo(refs, GenerateOptions{Package: "forms", Type: "Inspection", RefLoader: loader})
+	if err != nil {
+		t.Fatalf("TestGenerateGo error: %s", err)
+	}
+	if result := string(source); !strings.Contains(result, "\tMeters []InspectionMeters `alpaca:\"meters\" maxItems:\"4\"`\n") || !strings.Contains(result, "\tReading float64 `alpaca:\"reading\"`\n") {
+		t.Fatalf(`Should generate a struct for the meters, instead returned %s`, result)
+	}
+
+	if _, err := GenerateGo(schema, GenerateOptions{Package: "forms", Type: "not a type"}); err != ErrGenerateInvalid {
+		t.Fatalf(`Should return ErrGenerateInvalid, instead returned %v`, err)
+	}
+	if result := goName("2nd_floor-photo"); result != "N2ndFloorPhoto" {
+		t.Fatalf(`Should return N2ndFloorPhoto, instead returned %s`, result)
+	}
+}
+
+func TestSchemaRefs(t *testing.T) {
+	schema := `{
+		"schema": {
+			"type": "object",
+			"definitions": {
+				"yes_no": {
+					"type": "object",
+					"properties": {
+						"answer": {"type": "string", "title": "Answer", "enum": ["Yes", "No"]},
+						"comments": {"type": "string", "title": "Comments"}
+					},
+					"dependencies": {"comments": ["answer"]}
+				}
+			},
+			"properties": {
+				"building_intact": {"$ref": "#/definitions/yes_no", "title": "Building intact?"},
+				"site_secure": {"$ref": "#/definitions/yes_no", "title": "Is the site secure?"},
+				"meters": {"type": "array", "items": {"$ref": "common.json#/definitions/meter"}}
+			}
+		},
+		"options": {
+			"definitions": {
+				"yes_no": {
+					"fields": {
+						"answer": {"type": "radio", "optionLabels": ["Y", "N"]},
+						"comments": {"dependencies": {"answer": ["No"]}}
+					}
+				}
+			},
+			"fields": {
+				"building_intact": {"$ref": "#/definitions/yes_no"},
+				"site_secure": {"$ref": "#/definitions/yes_no", "order": 0}
+			}
+		}
+	}`
+	loader := FSRefLoader(fstest.MapFS{
+		"common.json": {Data: []byte(`{"definitions":{"meter":{"type":"object","properties":{"reading":{"$ref":"#/definitions/reading"},"photo":{"type":"string"}}},"reading":{"type":"number","title":"Reading"}}}`)},
+	})
+	data := `{"building_intact":{"answer":"No","comments":"Broken window"},"site_secure":{"answer":"Yes"},"meters":[{"reading":"12"}]}`
+
+	alpaca, err := New(AlpacaOptions{Schema: schema, Data: data, RefLoader: loader})
+	if err != nil {
+		t.Fatalf("TestSchemaRefs error: %s", err)
+	}
+	for path, expected := range map[string]string{
+		"building_intact":          "Building intact?",
+		"site_secure":              "Is the site secure?",
+		"building_intact.answer":   "Answer",
+		"site_secure.comments":     "Comments",
+		"meters[0].reading":        "Reading",
+		"building_intact.comments": "Comments",
+	} {
+		f := alpaca.FieldByPath(path)
+		if f == nil || f.Schema.S("title").Data() != expected {
+			t.Fatalf(`Should return %s field titled %s, instead returned %v`, path, expected, f)
+		}
+	}
+	if f := alpaca.FieldByPath("site_secure.answer"); f.Type != "radio" || f.EnumLabel != "Y" {
+		t.Fatalf(`Should return radio field labelled Y, instead returned %v`, f)
+	}
+	if f := alpaca.FieldByPath("building_intact"); f.Children[0].Key != "answer" {
+		t.Fatalf(`Should keep definition property order, instead returned %s`, f.Children[0].Key)
+	}
+	if f := alpaca.FieldByPath("meters[0].reading"); f.Type != "number" {
+		t.Fatalf(`Should return number field from loaded document, instead returned %v`, f)
+	}
+
+	if _, err := New(AlpacaOptions{Schema: schema, Data: data}); !errors.Is(err, ErrRefLoaderMissing) {
+		t.Fatalf(`Should return ErrRefLoaderMissing, instead returned %v`, err)
+	}
+	if _, err := New(AlpacaOptions{Schema: schema, Data: data, RefLoader: loader, MaxRefDepth: 1}); !errors.Is(err, ErrRefDepth) {
+		t.Fatalf(`Should return ErrRefDepth, instead returned %v`, err)
+	}
+
+	recursive := `{"schema":{"type":"object","definitions":{"node":{"type":"object","properties":{"name":{"type":"string"},"child":{"$ref":"#/definitions/node"}}}},"properties":{"root":{"$ref":"#/definitions/node"}}}}`
+	_, err = New(AlpacaOptions{Schema: recursive, Data: `{}`})
+	var fieldError *FieldError
+	if !errors.Is(err, ErrRefRecursive) || !errors.As(err, &fieldError) || fieldError.Path != "root.child" {
+		t.Fatalf(`Should return ErrRefRecursive at root.child, instead returned %v`, err)
+	}
+	exporter, err := NewCSVExporter(`{"schema":{"type":"object","definitions":{"meter":{"type":"object","properties":{"reading":{"type":"number"}}}},"properties":{"meters":{"type":"array","maxItems":2,"items":{"$ref":"#/definitions/meter"}}}}}`, CSVOptions{})
+	if err != nil {
+		t.Fatalf("TestSchemaRefs error: %s", err)
+	}
+	if result := strings.Join(exporter.Columns(), ","); result != "submission_id,meters[0].reading,meters[1].reading" {
+		t.Fatalf(`Should return columns for referenced items, instead returned %s`, result)
+	}
+	if _, err := New(AlpacaOptions{Schema: `{"schema":{"type":"object","properties":{"a":{"$ref":"#/definitions/missing"}}}}`, Data: `{}`}); !errors.Is(err, ErrRefInvalid) {
+		t.Fatalf(`Should return ErrRefInvalid, instead returned %v`, err)
+	}
+
+	// Relative $refs in a loaded document point beside it, and fragments are percent-decoded
+	nested := FSRefLoader(fstest.MapFS{
+		"defs/site.json":  {Data: []byte(`{"type":"object","properties":{"meter":{"$ref":"units.json#/definitions/meter%20reading"},"unit":{"$ref":"#/definitions/unit"}},"definitions":{"unit":{"type":"string","title":"Unit"}}}`)},
+		"defs/units.json": {Data: []byte(`{"definitions":{"meter reading":{"type":"number","title":"Meter reading"}}}`)},
+	})
+	alpaca, err = New(AlpacaOptions{Schema: `{"schema":{"type":"object","properties":{"site":{"$ref":"defs/site.json"}}}}`, Data: `{}`, RefLoader: nested})
+	if err != nil {
+		t.Fatalf("TestSchemaRefs error: %s", err)
+	}
+	if f := alpaca.FieldByPath("site.meter"); f == nil || f.Schema.S("title").Data() != "Meter reading" {
+		t.Fatalf(`Should return site.meter titled Meter reading, instead returned %v`, f)
+	}
+	if f := alpaca.FieldByPath("site.unit"); f == nil || f.Schema.S("title").Data() != "Unit" {
+		t.Fatalf(`Should return site.unit titled Unit, instead returned %v`, f)
+	}
+}
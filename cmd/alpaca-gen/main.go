@@ -0,0 +1,60 @@
+// Command alpaca-gen generates Go types for the answers of an Alpaca form from its schema and options.
+// It reads a {"schema":...,"options":...} document and is meant to be run by go generate:
+//
+//	//go:generate go run github.com/GeorgeD19/alpaca-go/cmd/alpaca-gen -in inspection.json -type Inspection
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/GeorgeD19/alpaca-go"
+)
+
+func main() {
+	in := flag.String("in", "", "schema and options document to read")
+	typeName := flag.String("type", "", "name of the generated struct")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated file, defaults to $GOPACKAGE")
+	out := flag.String("out", "", "file to write, defaults to <type>_alpaca.go, or - for standard output")
+	refs := flag.String("refs", "", "directory $refs to other documents are loaded from")
+	flag.Parse()
+
+	if *in == "" || *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	schema, err := ioutil.ReadFile(*in)
+	if err != nil {
+		fail(err)
+	}
+
+	options := alpaca.GenerateOptions{Package: *pkg, Type: *typeName}
+	if *refs != "" {
+		options.RefLoader = alpaca.FSRefLoader(os.DirFS(*refs))
+	}
+
+	source, err := alpaca.GenerateGo(string(schema), options)
+	if err != nil {
+		fail(err)
+	}
+
+	if *out == "-" {
+		os.Stdout.Write(source)
+		return
+	}
+	if *out == "" {
+		*out = strings.ToLower(*typeName) + "_alpaca.go"
+	}
+	if err := ioutil.WriteFile(*out, source, 0644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "alpaca-gen:", err)
+	os.Exit(1)
+}
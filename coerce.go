@@ -0,0 +1,202 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+// Coerce converts the submitted value of a field to the JSON type declared by its schema
+func (a *Alpaca) Coerce(f *Field) {
+	value := f.Data.Data()
+	if value == nil || value == "" {
+		return
+	}
+
+	// Items without a schema share their data with the parent
+	if f.SharesParentData() {
+		return
+	}
+
+	schemaType := f.GetCoercionType()
+	if schemaType == "" || IsSchemaType(value, schemaType) {
+		return
+	}
+
+	coerced, err := CoerceValue(value, schemaType)
+	if err != nil {
+		a.Coercions = append(a.Coercions, Coercion{Path: f.PathString, Type: schemaType, From: value, Err: err})
+		return
+	}
+
+	a.Coercions = append(a.Coercions, Coercion{Path: f.PathString, Type: schemaType, From: value, To: coerced})
+	a.SetFieldData(f, coerced)
+}
+
+// MergeCoercions adds the coercions recorded by a rebuild to earlier ones. Values that failed to coerce are still
+// in the data and fail again, so a rebuilt record replaces any earlier record for the same path.
+func MergeCoercions(previous []Coercion, rebuilt []Coercion) []Coercion {
+	paths := map[string]bool{}
+	for _, coercion := range rebuilt {
+		paths[coercion.Path] = true
+	}
+
+	merged := []Coercion{}
+	for _, coercion := range previous {
+		if !paths[coercion.Path] {
+			merged = append(merged, coercion)
+		}
+	}
+	return append(merged, rebuilt...)
+}
+
+// GetCoercionType returns the type a field's value should be coerced to.
+// Only declared types are used, falling back to the type shared by all enum values.
+func (f *Field) GetCoercionType() string {
+	if f.Schema.Exists("type") {
+		return f.SchemaType
+	}
+
+	enum, ok := f.Schema.S("enum").Data().([]interface{})
+	if !ok || len(enum) == 0 {
+		return ""
+	}
+
+	enumType := ""
+	for _, item := range enum {
+		itemType := ""
+		switch item.(type) {
+		case float64:
+			itemType = "number"
+		case bool:
+			itemType = "boolean"
+		case string:
+			itemType = "string"
+		}
+		if itemType == "" || (enumType != "" && itemType != enumType) {
+			return ""
+		}
+		enumType = itemType
+	}
+
+	return enumType
+}
+
+// SetFieldData replaces the data of a field, keeping the parent's data in step
+func (a *Alpaca) SetFieldData(f *Field, value interface{}) {
+	f.Data, _ = gabs.Consume(value)
+	f.DataString = f.Data.String()
+	f.Value = value
+
+	if f.Parent == nil {
+		a.data = f.Data
+		return
+	}
+
+	switch parent := f.Parent.Data.Data().(type) {
+	case map[string]interface{}:
+		parent[f.Key] = value
+	case []interface{}:
+		if f.IsArrayChild && f.ArrayIndex < len(parent) {
+			parent[f.ArrayIndex] = value
+		}
+	}
+}
+
+// CoerceValue converts a value to the given JSON schema type
+func CoerceValue(value interface{}, schemaType string) (interface{}, error) {
+	switch schemaType {
+	case "number", "integer":
+		var number float64
+		switch v := value.(type) {
+		case float64:
+			number = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, ErrCoercionInvalid
+			}
+			number = parsed
+		default:
+			return nil, ErrCoercionInvalid
+		}
+		if math.IsInf(number, 0) || math.IsNaN(number) {
+			return nil, ErrCoercionInvalid
+		}
+		if schemaType == "integer" && number != math.Trunc(number) {
+			return nil, ErrCoercionInvalid
+		}
+		return number, nil
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "on", "yes", "1", "checked":
+				return true, nil
+			case "false", "off", "no", "0":
+				return false, nil
+			}
+		}
+		return nil, ErrCoercionInvalid
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return nil, ErrCoercionInvalid
+	case "array":
+		switch v := value.(type) {
+		case []interface{}:
+			return v, nil
+		case string:
+			if trimmed := strings.TrimSpace(v); strings.HasPrefix(trimmed, "[") {
+				var items []interface{}
+				if err := json.Unmarshal([]byte(trimmed), &items); err == nil {
+					return items, nil
+				}
+			}
+		}
+		return []interface{}{value}, nil
+	}
+
+	return nil, ErrCoercionInvalid
+}
+
+// IsSchemaType reports whether a value already has the given JSON schema type
+func IsSchemaType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+
+	return true
+}
@@ -0,0 +1,110 @@
+package alpaca
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// CSVOptions configures a CSVExporter
+type CSVOptions struct {
+	// MaxItems is how many items of each repeatable get columns, capped by the schema's maxItems.
+	// It defaults to DefaultExportMaxItems.
+	MaxItems int
+	// ChildTables writes repeatables to tables of their own rather than expanding them into columns
+	ChildTables bool
+	// Labels writes enum labels rather than submitted values
+	Labels bool
+}
+
+// CSVExporter writes submissions of a form as rows with one column per answer the schema describes.
+// The columns depend on the schema alone, so they are the same for every submission.
+type CSVExporter struct {
+	options CSVOptions
+	layout  *exportLayout
+}
+
+// CSVTable is a table of exported answers. Child tables hold the items of a repeatable, named by its schema path,
+// and link them to their submission by id, the path of the repeatable and the item index.
+type CSVTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]string
+}
+
+// CSVSubmissionColumn heads the column holding the submission id
+const CSVSubmissionColumn = "submission_id"
+
+// NewCSVExporter derives the columns of a form from its schema
+func NewCSVExporter(schema string, options CSVOptions) (*CSVExporter, error) {
+	layout, err := newExportLayout(schema, options.MaxItems, options.ChildTables)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVExporter{options: options, layout: layout}, nil
+}
+
+// Columns returns the columns of the main table, starting with the submission id
+func (e *CSVExporter) Columns() []string {
+	columns := []string{CSVSubmissionColumn}
+	for _, column := range e.layout.Main.Columns {
+		columns = append(columns, column.Path)
+	}
+	return columns
+}
+
+// Tables returns the main table, named "", followed by a child table per repeatable when ChildTables is set
+func (e *CSVExporter) Tables(submissions []Submission) []CSVTable {
+	tables := []CSVTable{{Columns: e.Columns()}}
+	for _, table := range e.layout.Tables {
+		columns := []string{CSVSubmissionColumn, "parent", "index"}
+		for _, column := range table.Columns {
+			if column.Path == "" {
+				columns = append(columns, "value")
+			} else {
+				columns = append(columns, column.Path)
+			}
+		}
+		tables = append(tables, CSVTable{Name: table.Name, Columns: columns})
+	}
+
+	for _, submission := range submissions {
+		tables[0].Rows = append(tables[0].Rows, e.record([]string{submission.ID}, e.layout.Main.rows(submission.Form, false)[0]))
+		for i, table := range e.layout.Tables {
+			for _, row := range table.rows(submission.Form, true) {
+				tables[i+1].Rows = append(tables[i+1].Rows, e.record([]string{submission.ID, row.Parent, strconv.Itoa(row.Index)}, row))
+			}
+		}
+	}
+
+	return tables
+}
+
+// record appends the values of a row to the columns linking it to its submission
+func (e *CSVExporter) record(record []string, row exportRow) []string {
+	for _, f := range row.Fields {
+		if f == nil {
+			record = append(record, "")
+			continue
+		}
+		record = append(record, f.ExportValue(e.options.Labels))
+	}
+	return record
+}
+
+// Write writes the main table of the submissions as CSV
+func (e *CSVExporter) Write(w io.Writer, submissions []Submission) error {
+	return e.Tables(submissions)[0].Write(w)
+}
+
+// Write writes the table as CSV with a header row
+func (t CSVTable) Write(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.Columns); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
@@ -0,0 +1,158 @@
+package alpaca
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultDateLayouts are the input layouts accepted by date fields
+var DefaultDateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05.000",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// DefaultTimeLayouts are the input layouts accepted by time fields
+var DefaultTimeLayouts = []string{
+	"15:04:05",
+	"15:04",
+	"15:04:05.000",
+	"3:04:05 PM",
+	"3:04 PM",
+	"3:04:05PM",
+	"3:04PM",
+}
+
+// DefaultDateTimeLayouts are the input layouts accepted by datetime fields
+var DefaultDateTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05.000",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// DefaultMomentFormats are the moment.js formats Alpaca uses when a field has no dateFormat option
+var DefaultMomentFormats = map[string]string{
+	"date":     "MM/DD/YYYY",
+	"time":     "h:mm:ss a",
+	"datetime": "MM/DD/YYYY HH:mm:ss",
+}
+
+// momentTokens maps moment.js format tokens to Go layout elements, longest tokens first
+var momentTokens = []struct {
+	moment string
+	layout string
+}{
+	{"YYYY", "2006"},
+	{"YY", "06"},
+	{"MMMM", "January"},
+	{"MMM", "Jan"},
+	{"MM", "01"},
+	{"M", "1"},
+	{"dddd", "Monday"},
+	{"ddd", "Mon"},
+	{"DD", "02"},
+	{"D", "2"},
+	{"HH", "15"},
+	{"H", "15"},
+	{"hh", "03"},
+	{"h", "3"},
+	{"mm", "04"},
+	{"m", "4"},
+	{"ss", "05"},
+	{"s", "5"},
+	{"SSS", "000"},
+	{"SS", "00"},
+	{"S", "0"},
+	{"A", "PM"},
+	{"a", "pm"},
+	{"ZZ", "-0700"},
+	{"Z", "-07:00"},
+}
+
+// MomentToLayout translates a moment.js format string such as "MM/DD/YYYY HH:mm" into a Go time layout
+func MomentToLayout(format string) string {
+	layout := ""
+	for i := 0; i < len(format); {
+		// Text in square brackets is escaped in moment.js
+		if format[i] == '[' {
+			if end := strings.IndexByte(format[i:], ']'); end > 0 {
+				layout += format[i+1 : i+end]
+				i += end + 1
+				continue
+			}
+		}
+
+		matched := false
+		for _, token := range momentTokens {
+			if strings.HasPrefix(format[i:], token.moment) {
+				layout += token.layout
+				i += len(token.moment)
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			layout += format[i : i+1]
+			i++
+		}
+	}
+
+	return layout
+}
+
+// NormaliseTime parses value with the first matching layout and formats it in the canonical format.
+// Values without a zone are read in loc, values with one are converted to loc.
+func NormaliseTime(value string, layouts []string, format string, loc *time.Location) (string, bool) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return t.In(loc).Format(format), true
+		}
+	}
+
+	return "", false
+}
+
+// GetTimeLayouts returns the input layouts for a date, time or datetime field, led by its dateFormat option
+func (a *Alpaca) GetTimeLayouts(f *Field, kind string) []string {
+	layouts := []string{}
+
+	if f.Options.Exists("dateFormat") {
+		if format, ok := f.Options.S("dateFormat").Data().(string); ok && format != "" {
+			layouts = append(layouts, MomentToLayout(format))
+		}
+	} else {
+		layouts = append(layouts, MomentToLayout(DefaultMomentFormats[kind]))
+	}
+
+	switch kind {
+	case "date":
+		if a.dateTime.DateLayouts != nil {
+			return append(layouts, a.dateTime.DateLayouts...)
+		}
+		return append(layouts, DefaultDateLayouts...)
+	case "time":
+		if a.dateTime.TimeLayouts != nil {
+			return append(layouts, a.dateTime.TimeLayouts...)
+		}
+		return append(layouts, DefaultTimeLayouts...)
+	}
+
+	if a.dateTime.DateTimeLayouts != nil {
+		return append(layouts, a.dateTime.DateTimeLayouts...)
+	}
+	return append(layouts, DefaultDateTimeLayouts...)
+}
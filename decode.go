@@ -0,0 +1,275 @@
+package alpaca
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media holds the photos of a camera or signature field when decoding into structs
+type Media []ImageFile
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	imageFileType = reflect.TypeOf(ImageFile{})
+	mediaType     = reflect.TypeOf(Media{})
+	imageFileList = reflect.TypeOf([]ImageFile{})
+)
+
+// DecodeError reports a field value that cannot be stored in the struct field tagged with its path
+type DecodeError struct {
+	Path  string
+	Field string
+	Type  reflect.Type
+	Value interface{}
+}
+
+func (e *DecodeError) Error() string {
+	return e.Path + ": " + strings.TrimSuffix(ErrDecodeType.Error(), ".") + " " + e.Field + " (" + e.Type.String() + ")."
+}
+
+// Unwrap returns ErrDecodeType so it can be matched with errors.Is
+func (e *DecodeError) Unwrap() error {
+	return ErrDecodeType
+}
+
+// Decode stores the answers of a form in the struct v points to. Struct fields are matched by their alpaca tag,
+// a field path relative to the enclosing struct such as `alpaca:"list_of_electrical[].electrical_device"`,
+// where [] collects the answer from every item of a repeatable. Untagged fields are left alone.
+//
+// Repeatables decode into slices of structs or values, date fields into time.Time and camera fields into Media.
+// Answers that were not given leave the zero value, or nil for pointers.
+func Decode(a *Alpaca, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrDecodeTarget
+	}
+	return a.decodeStruct("", rv.Elem())
+}
+
+// decodeStruct decodes the tagged fields of a struct relative to a field path
+func (a *Alpaca) decodeStruct(prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("alpaca")
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		path := strings.Split(tag, ",")[0]
+		if err := a.decodePath(JoinPath(prefix, path), field.Name, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JoinPath appends a relative field path to another, e.g. list[0] and name become list[0].name
+func JoinPath(prefix string, path string) string {
+	if prefix == "" || path == "" {
+		return prefix + path
+	}
+	if strings.HasPrefix(path, "[") {
+		return prefix + path
+	}
+	return prefix + "." + path
+}
+
+// decodePath decodes the answer at a path, which may collect answers from the items of repeatables
+func (a *Alpaca) decodePath(path string, name string, rv reflect.Value) error {
+	split := strings.Index(path, "[]")
+	if split < 0 {
+		return a.decodeField(path, name, rv)
+	}
+
+	base, rest := path[:split], path[split+2:]
+	if rv.Kind() != reflect.Slice {
+		return &DecodeError{Path: path, Field: name, Type: rv.Type()}
+	}
+
+	f := a.FieldByPath(base)
+	if f == nil {
+		return nil
+	}
+
+	items := reflect.MakeSlice(rv.Type(), 0, len(f.Children))
+	for _, item := range f.Children {
+		if item.SharesParentData() {
+			continue
+		}
+		elem := reflect.New(rv.Type().Elem()).Elem()
+		if err := a.decodePath(item.PathString+rest, name, elem); err != nil {
+			return err
+		}
+		items = reflect.Append(items, elem)
+	}
+	rv.Set(items)
+	return nil
+}
+
+// decodeField decodes the answer of the field at path into a value
+func (a *Alpaca) decodeField(path string, name string, rv reflect.Value) error {
+	f := a.FieldByPath(path)
+	if f == nil {
+		return nil
+	}
+
+	// Photos arrive with the request rather than in the data
+	switch rv.Type() {
+	case mediaType, imageFileList:
+		rv.Set(reflect.ValueOf(f.Media).Convert(rv.Type()))
+		return nil
+	case imageFileType:
+		if len(f.Media) > 0 {
+			rv.Set(reflect.ValueOf(f.Media[0]))
+		}
+		return nil
+	}
+
+	if !f.IsSubmitted() {
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if f.Value == nil {
+			return nil
+		}
+		elem := reflect.New(rv.Type().Elem())
+		if err := a.decodeField(path, name, elem.Elem()); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	case reflect.Struct:
+		if rv.Type() != timeType {
+			return a.decodeStruct(path, rv)
+		}
+	case reflect.Slice:
+		return a.decodeSlice(f, name, rv)
+	case reflect.Interface:
+		if f.Value != nil && reflect.TypeOf(f.Value).AssignableTo(rv.Type()) {
+			rv.Set(reflect.ValueOf(f.Value))
+		}
+		return nil
+	}
+
+	if IsEmptyValue(f.Value) {
+		return nil
+	}
+	if err := decodeValue(f, f.Value, rv); err != nil {
+		return &DecodeError{Path: f.PathString, Field: name, Type: rv.Type(), Value: f.Value}
+	}
+	return nil
+}
+
+// decodeSlice decodes a repeatable or multi-value answer into a slice
+func (a *Alpaca) decodeSlice(f *Field, name string, rv reflect.Value) error {
+	elemType := rv.Type().Elem()
+	if elemType.Kind() == reflect.Struct && elemType != timeType {
+		items := reflect.MakeSlice(rv.Type(), 0, len(f.Children))
+		for _, item := range f.Children {
+			if item.SharesParentData() {
+				continue
+			}
+			elem := reflect.New(elemType).Elem()
+			if err := a.decodeStruct(item.PathString, elem); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem)
+		}
+		rv.Set(items)
+		return nil
+	}
+
+	values, ok := f.Value.([]interface{})
+	if !ok && f.Type == "checkbox" {
+		values, ok = f.GetEnumValues(), true
+	}
+	if !ok {
+		if IsEmptyValue(f.Value) {
+			return nil
+		}
+		return &DecodeError{Path: f.PathString, Field: name, Type: rv.Type(), Value: f.Value}
+	}
+
+	items := reflect.MakeSlice(rv.Type(), 0, len(values))
+	for i, value := range values {
+		elem := reflect.New(elemType).Elem()
+		if err := decodeValue(f, value, elem); err != nil {
+			return &DecodeError{Path: f.PathString + "[" + strconv.Itoa(i) + "]", Field: name, Type: elemType, Value: value}
+		}
+		items = reflect.Append(items, elem)
+	}
+	rv.Set(items)
+	return nil
+}
+
+// decodeValue stores a single value, converting it by the same rules as coercion
+func decodeValue(f *Field, value interface{}, rv reflect.Value) error {
+	if rv.Type() == timeType {
+		str, ok := value.(string)
+		if !ok {
+			return ErrDecodeType
+		}
+		t, err := f.ParseTime(str)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		str, ok := value.(string)
+		if !ok {
+			return ErrDecodeType
+		}
+		rv.SetString(str)
+	case reflect.Bool:
+		coerced, err := CoerceValue(value, "boolean")
+		if err != nil {
+			return err
+		}
+		rv.SetBool(coerced.(bool))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		coerced, err := CoerceValue(value, "integer")
+		if err != nil {
+			return err
+		}
+		number := int64(coerced.(float64))
+		if rv.OverflowInt(number) {
+			return ErrDecodeType
+		}
+		rv.SetInt(number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		coerced, err := CoerceValue(value, "integer")
+		if err != nil {
+			return err
+		}
+		number := coerced.(float64)
+		if number < 0 || rv.OverflowUint(uint64(number)) {
+			return ErrDecodeType
+		}
+		rv.SetUint(uint64(number))
+	case reflect.Float32, reflect.Float64:
+		coerced, err := CoerceValue(value, "number")
+		if err != nil {
+			return err
+		}
+		if rv.OverflowFloat(coerced.(float64)) {
+			return ErrDecodeType
+		}
+		rv.SetFloat(coerced.(float64))
+	case reflect.Interface:
+		if value == nil || !reflect.TypeOf(value).AssignableTo(rv.Type()) {
+			return ErrDecodeType
+		}
+		rv.Set(reflect.ValueOf(value))
+	default:
+		return ErrDecodeType
+	}
+	return nil
+}
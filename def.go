@@ -45,6 +45,70 @@ type AlpacaOptions struct {
 	Schema  string
 	Data    string
 	Request *http.Request
+	// Coerce converts submitted values to the type declared by their schema
+	Coerce bool
+	// DateTime configures how date, time and datetime values are normalised
+	DateTime DateTimeOptions
+	// CheckboxFormat rewrites multi-value checkbox answers in a single representation
+	CheckboxFormat CheckboxFormat
+	// IDStrategy decides how field IDs are generated
+	IDStrategy IDStrategy
+	// Protect replaces submitted values of readonly and hidden fields, recording each override in TamperEvents
+	Protect bool
+	// ServerValues are the trusted values of readonly and hidden fields, keyed by field pointer, e.g. /devices/0/serial
+	ServerValues map[string]interface{}
+	// AdditionalProperties decides what happens to submitted properties the schema does not describe
+	AdditionalProperties AdditionalProperties
+	// RefLoader loads the documents $refs point into other than the form itself
+	RefLoader RefLoader
+	// MaxRefDepth bounds how many $refs may be active at once, defaulting to DefaultMaxRefDepth
+	MaxRefDepth int
+	// MaxDepth bounds how deeply fields may be nested, defaulting to DefaultMaxDepth
+	MaxDepth int
+}
+
+// CheckboxFormat is the representation of a multi-value checkbox answer
+type CheckboxFormat string
+
+const (
+	// CheckboxFormatUnchanged leaves checkbox answers as submitted
+	CheckboxFormatUnchanged CheckboxFormat = ""
+	// CheckboxFormatArray writes answers as a list of values, e.g. ["Fire","Flood"]
+	CheckboxFormatArray CheckboxFormat = "array"
+	// CheckboxFormatObjects writes answers as a list of objects, e.g. [{"value":"Fire","text":"Fire"}]
+	CheckboxFormatObjects CheckboxFormat = "objects"
+	// CheckboxFormatString writes answers as a comma-joined string, e.g. "Fire,Flood"
+	CheckboxFormatString CheckboxFormat = "string"
+)
+
+// DateTimeOptions configures date, time and datetime normalisation. Layouts replace the defaults when set,
+// and a field's moment.js dateFormat option is always tried first.
+type DateTimeOptions struct {
+	// Normalise rewrites values in the canonical formats, otherwise they are kept as submitted
+	Normalise       bool
+	DateLayouts     []string
+	TimeLayouts     []string
+	DateTimeLayouts []string
+	// Canonical output layouts, defaulting to 2006-01-02, 15:04:05 and 2006-01-02 15:04:05
+	DateFormat     string
+	TimeFormat     string
+	DateTimeFormat string
+	// Location overrides the form's timezone option, defaulting to UTC
+	Location *time.Location
+}
+
+// ParseOptions configures the output of ParseWith
+type ParseOptions struct {
+	// FormOrder emits object keys in form order rather than alphabetical
+	FormOrder bool
+	// Labels swaps enum values for their optionLabels entries
+	Labels bool
+	// Titles keys properties by their title rather than their key
+	Titles bool
+	// Tuples swaps each answer for a {key, title, value, label} object
+	Tuples bool
+	// Empty decides how answers submitted empty are written, fields can override it with the emptyValue option
+	Empty EmptyPolicy
 }
 
 // Alpaca is the main operator of this package
@@ -52,10 +116,31 @@ type Alpaca struct {
 	data            *gabs.Container
 	schema          *gabs.Container
 	options         *gabs.Container
+	order           keyOrder
 	connector       string
 	request         *http.Request
+	fieldIndex      map[string]*Field
+	pointerIndex    map[string]*Field
+	coerce          bool
+	dateTime        DateTimeOptions
+	location        *time.Location
+	checkboxFormat  CheckboxFormat
+	idStrategy      IDStrategy
+	ids             map[string]bool
+	protect         bool
+	serverValues    map[string]interface{}
+	strictMode      AdditionalProperties
+	additional      []additionalProperty
+	refLoader       RefLoader
+	maxRefDepth     int
+	maxDepth        int
+	refDocuments    map[string]*gabs.Container
+	refs            []activeRef
 	FieldRegistry   []*Field
 	MediaRegistry   []ImageFile
+	Coercions       []Coercion
+	TamperEvents    []TamperEvent
+	AdditionalPaths []string
 	UniqueIDCounter int
 	output          string
 }
@@ -70,6 +155,19 @@ type Chunk struct {
 	Field     *Field
 }
 
+// SortKey is the position of a field within the field tree, one entry per level
+type SortKey []int
+
+// Less reports whether k sorts before other, parents sorting before their children
+func (k SortKey) Less(other SortKey) bool {
+	for i := 0; i < len(k) && i < len(other); i++ {
+		if k[i] != other[i] {
+			return k[i] < other[i]
+		}
+	}
+	return len(k) < len(other)
+}
+
 // Field is a field of any kind
 type Field struct {
 	Data                *gabs.Container
@@ -87,6 +185,8 @@ type Field struct {
 	Type                string
 	Path                []Chunk
 	PathString          string
+	Pointer             string
+	JSONPath            string
 	Validate            string
 	ShowingDefaultData  string
 	PreviouslyValidated bool
@@ -97,15 +197,19 @@ type Field struct {
 	DefaultType         string
 	Order               float64
 	ReadOnly            bool
+	Hidden              bool
 	notTopLevel         bool
 	IsArrayChild        bool
 	ArrayIndex          int
 	ArrayValues         int
 	Depth               int
-	DepthOrder          float64
+	SortKey             SortKey
 	Media               []ImageFile
 	Enum                []Enum
 	EnumLabel           string
+	EnumLabels          []string
+	InvalidEnumValues   []interface{}
+	alpaca              *Alpaca
 }
 
 type Enum struct {
@@ -113,6 +217,16 @@ type Enum struct {
 	Label interface{}
 }
 
+// Coercion records a submitted value being converted to its schema type.
+// Err is set when the value could not be converted and was left as submitted.
+type Coercion struct {
+	Path string
+	Type string
+	From interface{}
+	To   interface{}
+	Err  error
+}
+
 // StandardFile type is a common base for files.
 type StandardFile struct {
 	Data     string
@@ -142,4 +256,65 @@ var (
 	ErrDefaultError  = errors.New("You must supply at least one argument.")
 	ErrSchemaInvalid = errors.New("Invalid schema supplied.")
 	ErrDataInvalid   = errors.New("Invalid data supplied.")
+
+	ErrNoFields            = errors.New("No fields have been registered.")
+	ErrTypeInvalid         = errors.New("Invalid type supplied.")
+	ErrMaxItemsInvalid     = errors.New("Invalid maxItems supplied.")
+	ErrMaxImageInvalid     = errors.New("Invalid maxImage supplied.")
+	ErrImageTooLarge       = errors.New("Image has too many pixels.")
+	ErrOptionLabelsInvalid = errors.New("Option labels do not match enum.")
+	ErrCoercionInvalid     = errors.New("Value cannot be converted to schema type.")
+	ErrTimezoneInvalid     = errors.New("Invalid timezone supplied.")
+	ErrTimeInvalid         = errors.New("Value is not a valid time.")
+	ErrFieldNotFound       = errors.New("No field exists at path.")
+	ErrNotArray            = errors.New("Field is not an array.")
+	ErrIndexOutOfRange     = errors.New("Index is out of range.")
+	ErrMaxItemsExceeded    = errors.New("Array already holds maxItems items.")
+	ErrPathInvalid         = errors.New("Invalid path supplied.")
+	ErrFieldDepth          = errors.New("Fields are nested too deeply.")
+
+	ErrAdditionalProperties = errors.New("Data contains properties not described by the schema.")
+
+	ErrDecodeTarget = errors.New("Decode requires a pointer to a struct.")
+	ErrDecodeType   = errors.New("Value cannot be decoded into field.")
+
+	ErrStructInvalid     = errors.New("Schema can only be generated from a struct.")
+	ErrStructTagInvalid  = errors.New("Invalid struct tag supplied.")
+	ErrStructTypeInvalid = errors.New("Field type cannot be described by a schema.")
+	ErrStructRecursive   = errors.New("Struct refers to itself.")
+
+	ErrPropertyInvalid   = errors.New("Invalid property key supplied.")
+	ErrPropertyDuplicate = errors.New("Property has already been added.")
+	ErrDependencyInvalid = errors.New("Dependency refers to an unknown property.")
+	ErrItemsMissing      = errors.New("Array has no items.")
+
+	ErrGenerateInvalid = errors.New("Code can only be generated for an object schema with a valid package and type name.")
+
+	ErrRefInvalid       = errors.New("Invalid $ref supplied.")
+	ErrRefRecursive     = errors.New("$ref refers to itself.")
+	ErrRefDepth         = errors.New("$refs are nested too deeply.")
+	ErrRefLoaderMissing = errors.New("No loader is configured for $refs to other documents.")
 )
+
+// FieldError annotates an error with the path of the field it occurred on.
+// Pointer holds the lossless JSON Pointer of the field when it is known.
+type FieldError struct {
+	Path    string
+	Pointer string
+	ID      string
+	Err     error
+}
+
+// NewFieldError annotates an error with the path, pointer and ID of a field
+func NewFieldError(f *Field, err error) *FieldError {
+	return &FieldError{Path: f.PathString, Pointer: f.Pointer, ID: f.ID, Err: err}
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error so it can be matched with errors.Is
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
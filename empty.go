@@ -0,0 +1,86 @@
+package alpaca
+
+import (
+	"github.com/spf13/cast"
+)
+
+// EmptyPolicy decides how answers that were submitted empty are written by ParseWith.
+// Fields missing from the data are never answered and always omitted, other than checkboxes.
+type EmptyPolicy string
+
+const (
+	// EmptyOmit leaves empty answers out of the output
+	EmptyOmit EmptyPolicy = ""
+	// EmptyNull writes empty answers as null so saved answers can be cleared
+	EmptyNull EmptyPolicy = "null"
+	// EmptyString writes empty answers as ""
+	EmptyString EmptyPolicy = "string"
+)
+
+// IsEmptyValue reports whether a value is null, an empty string, an empty array or an empty object
+func IsEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// GetEmptyPolicy returns the empty policy of a field, its emptyValue option overriding the given policy
+func (f *Field) GetEmptyPolicy(policy EmptyPolicy) EmptyPolicy {
+	if f.Options.Exists("emptyValue") {
+		switch override := EmptyPolicy(cast.ToString(f.Options.S("emptyValue").Data())); override {
+		case "omit":
+			return EmptyOmit
+		case EmptyNull, EmptyString:
+			return override
+		}
+	}
+	return policy
+}
+
+// GetEmptyValue returns the value an empty answer is written as and whether it is written at all
+func (f *Field) GetEmptyValue(policy EmptyPolicy) (interface{}, bool) {
+	switch f.GetEmptyPolicy(policy) {
+	case EmptyNull:
+		return nil, true
+	case EmptyString:
+		return "", true
+	}
+	return nil, false
+}
+
+// IsEmptyAnswer reports whether a field was submitted without a value. Fields within another answer,
+// such as the items of a multi-value enum, are part of that answer rather than answers of their own.
+// Checkboxes missing from submitted objects were left unticked, so they are empty too.
+func (f *Field) IsEmptyAnswer() bool {
+	if f.Parent == nil || f.SharesParentData() || f.Parent.IsAnswer() {
+		return false
+	}
+	if !f.IsSubmitted() {
+		return f.Type == "checkbox" && f.Parent.IsSubmitted()
+	}
+	if f.IsContainerField && !f.IsAnswer() {
+		return IsEmptyValue(f.Data.Data())
+	}
+	return IsEmptyValue(f.Value)
+}
+
+// MergeEmptyAnswers writes the empty answers that the policy emits into generated output
+func (a *Alpaca) MergeEmptyAnswers(output interface{}, policy EmptyPolicy) interface{} {
+	for _, f := range a.FieldRegistry {
+		if !f.IsEmptyAnswer() {
+			continue
+		}
+		if value, ok := f.GetEmptyValue(policy); ok {
+			output = setIn(output, f.dataSegments(), value)
+		}
+	}
+	return output
+}
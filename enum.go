@@ -0,0 +1,112 @@
+package alpaca
+
+import (
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/spf13/cast"
+)
+
+// GetEnumSchema returns the enum backing a field, looking into array items for multi-value fields
+func (f *Field) GetEnumSchema() *gabs.Container {
+	if f.Schema.Exists("enum") {
+		return f.Schema.S("enum")
+	}
+	if f.Schema.Exists("items", "enum") {
+		return f.Schema.S("items", "enum")
+	}
+	return nil
+}
+
+// GetEnumValues returns the submitted values of an enum-backed field.
+// Multi-value checkboxes may submit a list of values, a list of {"value": ...} objects or a comma-joined string.
+func (f *Field) GetEnumValues() []interface{} {
+	switch v := f.Value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		values := []interface{}{}
+		for _, item := range v {
+			if object, ok := item.(map[string]interface{}); ok {
+				item = object["value"]
+			}
+			values = append(values, item)
+		}
+		return values
+	case string:
+		if v == "" {
+			return nil
+		}
+		if f.Type == "checkbox" && f.SchemaType != "boolean" {
+			values := []interface{}{}
+			for _, item := range strings.Split(v, ",") {
+				values = append(values, item)
+			}
+			return values
+		}
+	}
+
+	return []interface{}{f.Value}
+}
+
+// ResolveEnum fills in the enum values and labels of any enum-backed field, along with the labels of the submitted values.
+// Submitted values that are not part of the enum are collected in InvalidEnumValues.
+func (a *Alpaca) ResolveEnum(f *Field) error {
+	enumSchema := f.GetEnumSchema()
+	if enumSchema == nil {
+		return nil
+	}
+
+	enum, ok := enumSchema.Data().([]interface{})
+	if !ok {
+		return nil
+	}
+
+	labels := make([]interface{}, len(enum))
+	copy(labels, enum)
+
+	optionLabels := f.Options.S("optionLabels")
+	if optionLabels == nil {
+		optionLabels = f.Options.S("items", "optionLabels")
+	}
+	// Items of a multi-value field share the labels of their parent
+	if optionLabels == nil && f.IsArrayChild && f.Parent != nil && f.Parent.Schema.Exists("items", "enum") {
+		optionLabels = f.Parent.Options.S("optionLabels")
+	}
+	if optionLabels != nil {
+		custom, ok := optionLabels.Data().([]interface{})
+		if !ok || len(custom) < len(enum) {
+			return NewFieldError(f, ErrOptionLabelsInvalid)
+		}
+		copy(labels, custom)
+	}
+
+	f.Enum = nil
+	for i := range enum {
+		f.Enum = append(f.Enum, Enum{Value: enum[i], Label: labels[i]})
+	}
+
+	f.EnumLabel = ""
+	f.EnumLabels = nil
+	f.InvalidEnumValues = nil
+	for _, value := range f.GetEnumValues() {
+		label, found := f.GetEnumLabel(value)
+		if !found {
+			f.InvalidEnumValues = append(f.InvalidEnumValues, value)
+		}
+		f.EnumLabels = append(f.EnumLabels, label)
+	}
+	f.EnumLabel = strings.Join(f.EnumLabels, ", ")
+
+	return nil
+}
+
+// GetEnumLabel returns the label of an enum value, falling back to the value itself when it is not in the enum
+func (f *Field) GetEnumLabel(value interface{}) (string, bool) {
+	for _, item := range f.Enum {
+		if cast.ToString(value) == cast.ToString(item.Value) {
+			return cast.ToString(item.Label), true
+		}
+	}
+	return cast.ToString(value), false
+}
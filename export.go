@@ -0,0 +1,250 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+	"github.com/spf13/cast"
+)
+
+// DefaultExportMaxItems is how many items of a repeatable get columns when no limit is configured
+const DefaultExportMaxItems = 10
+
+// Submission is a parsed form submission identified for export
+type Submission struct {
+	ID   string
+	Form *Alpaca
+}
+
+// GetSchemaPath returns the path of a field with array indexes removed, e.g. devices[].name, so the answers
+// of every item of a repeatable share it
+func (f *Field) GetSchemaPath() string {
+	if f.Parent == nil {
+		return ""
+	}
+	parent := f.Parent.GetSchemaPath()
+	if f.Parent.ChunkType == "array" || f.Parent.ChunkType == "repeatable" {
+		return parent + "[]"
+	}
+	if parent == "" {
+		return f.Key
+	}
+	return parent + "." + f.Key
+}
+
+// IsExportLeaf reports whether a field holds an answer of its own that exports as a single value
+func (f *Field) IsExportLeaf() bool {
+	if f.Parent == nil || f.SharesParentData() || f.Parent.IsAnswer() {
+		return false
+	}
+	switch f.Type {
+	case "information", "image":
+		return false
+	}
+	return f.IsAnswer() || len(f.Children) == 0
+}
+
+// ExportValue returns the answer of a field as a single string, as its label or as the submitted value.
+// Fields missing from the data export as an empty string.
+func (f *Field) ExportValue(labels bool) string {
+	if !f.IsSubmitted() {
+		return ""
+	}
+	if labels {
+		return f.DisplayValue(false)
+	}
+
+	return ExportString(f.Value)
+}
+
+// ExportString returns a submitted value as a single string, encoding arrays and objects as JSON
+func ExportString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return cast.ToString(value)
+	}
+	return string(encoded)
+}
+
+// NewSkeleton parses a form with placeholder data holding items items for each array, capped by maxItems,
+// so every field the schema describes is registered whatever was submitted. $refs to other documents
+// are loaded with loader, which may be nil when there are none.
+func NewSkeleton(schema string, items int, loader RefLoader) (*Alpaca, error) {
+	parsed, err := gabs.ParseJSON([]byte(schema))
+	if err != nil {
+		return nil, ErrSchemaInvalid
+	}
+
+	// The $refs of the schema are followed as the form will follow them
+	refs := &Alpaca{schema: parsed.S("schema"), order: keyOrder{}, refLoader: loader, maxRefDepth: DefaultMaxRefDepth}
+	data, err := json.Marshal(refs.skeletonData(parsed.S("schema"), items))
+	if err != nil {
+		return nil, err
+	}
+
+	return New(AlpacaOptions{Schema: schema, Data: string(data), RefLoader: loader})
+}
+
+// skeletonData returns placeholder data with the shape of a schema, following its $refs
+func (a *Alpaca) skeletonData(schema *gabs.Container, items int) interface{} {
+	schema, refs, err := a.resolveRef(schema, a.schema, false)
+	defer a.releaseRefs(refs)
+	if err != nil {
+		return nil
+	}
+
+	if properties, err := schema.S("properties").ChildrenMap(); err == nil {
+		object := map[string]interface{}{}
+		for key, property := range properties {
+			object[key] = a.skeletonData(property, items)
+		}
+		return object
+	}
+
+	if schema.Exists("items") {
+		if maxItems, err := cast.ToIntE(schema.S("maxItems").Data()); err == nil && schema.Exists("maxItems") && maxItems < items {
+			items = maxItems
+		}
+		array := []interface{}{}
+		for i := 0; i < items; i++ {
+			array = append(array, a.skeletonData(schema.S("items"), items))
+		}
+		return array
+	}
+
+	return nil
+}
+
+// exportColumn is an answer exported to a column. The field comes from the skeleton and describes the column.
+type exportColumn struct {
+	Path  string
+	Field *Field
+}
+
+// exportTable is a table of exported answers. Child tables hold the items of a repeatable, named by its schema path,
+// with column paths relative to the item.
+type exportTable struct {
+	Name    string
+	Columns []exportColumn
+}
+
+// exportRow is a row of a table, child table rows being linked to the repeatable and item they came from
+type exportRow struct {
+	Parent string
+	Index  int
+	Fields []*Field
+}
+
+// exportLayout is the main table and child tables of a form, derived from its schema alone
+// so they are the same for every submission
+type exportLayout struct {
+	Main   *exportTable
+	Tables []*exportTable
+}
+
+// newExportLayout derives the tables of a form. Repeatables are expanded into maxItems columns per item property,
+// or given child tables of their own.
+func newExportLayout(schema string, maxItems int, childTables bool) (*exportLayout, error) {
+	if maxItems <= 0 {
+		maxItems = DefaultExportMaxItems
+	}
+	if childTables {
+		maxItems = 1
+	}
+	skeleton, err := NewSkeleton(schema, maxItems, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &exportLayout{Main: &exportTable{}}
+	tables := map[string]*exportTable{}
+	for _, f := range skeleton.FieldRegistry {
+		if childTables && f.IsRepeatable() && f.Schema.Exists("items") {
+			table := &exportTable{Name: f.GetSchemaPath()}
+			tables[table.Name] = table
+			layout.Tables = append(layout.Tables, table)
+		}
+		if !f.IsExportLeaf() {
+			continue
+		}
+
+		repeatable := f.GetRepeatable()
+		if !childTables || repeatable == nil {
+			layout.Main.Columns = append(layout.Main.Columns, exportColumn{Path: f.PathString, Field: f})
+			continue
+		}
+
+		// The first item stands in for all of them
+		item := f.GetRepeatableItem()
+		path := strings.TrimPrefix(strings.TrimPrefix(f.PathString, item.PathString), ".")
+		table := tables[repeatable.GetSchemaPath()]
+		table.Columns = append(table.Columns, exportColumn{Path: path, Field: f})
+	}
+
+	return layout, nil
+}
+
+// rows returns the fields of a submission for each row of a table. Answers that were not given are nil.
+func (t *exportTable) rows(form *Alpaca, child bool) []exportRow {
+	if !child {
+		row := exportRow{}
+		for _, column := range t.Columns {
+			row.Fields = append(row.Fields, form.FieldByPath(column.Path))
+		}
+		return []exportRow{row}
+	}
+
+	rows := []exportRow{}
+	for _, f := range form.FieldRegistry {
+		if !f.IsRepeatable() || f.GetSchemaPath() != t.Name {
+			continue
+		}
+		for _, item := range f.Children {
+			if item.SharesParentData() {
+				continue
+			}
+			row := exportRow{Parent: f.PathString, Index: item.ArrayIndex}
+			for _, column := range t.Columns {
+				path := item.PathString
+				if column.Path != "" {
+					path += "." + column.Path
+				}
+				row.Fields = append(row.Fields, form.FieldByPath(path))
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// GetRepeatable returns the closest repeatable a field is in, or nil when it is in none
+func (f *Field) GetRepeatable() *Field {
+	for parent := f.Parent; parent != nil; parent = parent.Parent {
+		if parent.IsRepeatable() && parent.Schema.Exists("items") {
+			return parent
+		}
+	}
+	return nil
+}
+
+// GetRepeatableItem returns the item of the closest repeatable a field is in, which may be the field itself
+func (f *Field) GetRepeatableItem() *Field {
+	for item := f; item.Parent != nil; item = item.Parent {
+		if item.Parent.IsRepeatable() && item.Parent.Schema.Exists("items") {
+			return item
+		}
+	}
+	return nil
+}
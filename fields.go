@@ -5,18 +5,24 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/spf13/cast"
 )
 
 // Array container field
-func (a *Alpaca) Array(f *Field) {
+func (a *Alpaca) Array(f *Field) error {
 	f.IsContainerField = true
 
-	maxItems := 1
-	if f.Schema.Exists("maxItems") {
-		maxItems = cast.ToInt(f.Schema.S("maxItems").Data().(float64))
+	maxItems, err := f.GetMaxItems()
+	if err != nil {
+		return err
+	}
+
+	// Only resolve the items that were submitted
+	if items, ok := f.Data.Data().([]interface{}); !ok {
+		maxItems = 0
+	} else if maxItems < 0 || len(items) < maxItems {
+		maxItems = len(items)
 	}
 
 	isInt := false
@@ -28,43 +34,85 @@ func (a *Alpaca) Array(f *Field) {
 
 	if f.Schema.Exists("items") {
 		for x := 0; x < maxItems; x++ {
-			a.ResolveItemSchemaOptions(f.Key, f, x)
+			if err := a.ResolveItemSchemaOptions(f.Key, f, x); err != nil {
+				return err
+			}
 		}
-	} else if isInt {
+	} else if isInt && (f.Parent == nil || f.Parent.Key != f.Key) {
+		// Items without a schema resolve to themselves, so only descend once
 		if f.SchemaType == "" {
-			a.ResolveItemSchemaOptions(f.Key, f, intVal)
+			if err := a.ResolveItemSchemaOptions(f.Key, f, intVal); err != nil {
+				return err
+			}
+		}
+	}
+
+	a.RegisterField(f)
+	return nil
+}
+
+// Checkbox control field
+func (a *Alpaca) Checkbox(f *Field) error {
+	if a.checkboxFormat != CheckboxFormatUnchanged && f.GetEnumSchema() != nil && f.SchemaType != "boolean" {
+		a.NormaliseCheckbox(f)
+		if err := a.ResolveEnum(f); err != nil {
+			return err
 		}
 	}
+	return a.Array(f)
+}
+
+// NormaliseCheckbox rewrites a multi-value checkbox answer in the configured format.
+// Values are trimmed and matched against the enum, values outside the enum are kept and flagged by ResolveEnum.
+func (a *Alpaca) NormaliseCheckbox(f *Field) {
+	values := f.GetEnumValues()
+	if values == nil {
+		return
+	}
 
-	if f.Type == "select" {
-		if f.Schema.Exists("enum") {
-			enum, err := f.Schema.S("enum").Children()
-			if err == nil {
-				// Enum fallback value
-				for i := 0; i < len(enum); i++ {
-					if cast.ToString(f.Value) == cast.ToString(enum[i].Data()) {
-						f.EnumLabel = cast.ToString(enum[i].Data())
-					}
-				}
-				if f.Options.Exists("optionLabels") {
-					optionLabels, err := f.Options.S("optionLabels").Children()
-					if err == nil {
-						for i := 0; i < len(enum); i++ {
-							if cast.ToString(f.Value) == cast.ToString(enum[i].Data()) {
-								f.EnumLabel = cast.ToString(optionLabels[i].Data())
-							}
-							f.Enum = append(f.Enum, Enum{
-								Value: enum[i].Data(),
-								Label: optionLabels[i].Data(),
-							})
-						}
-					}
-				}
+	normalised := []interface{}{}
+	for _, value := range values {
+		str := strings.TrimSpace(cast.ToString(value))
+		if str == "" {
+			continue
+		}
+
+		var matched interface{} = str
+		for _, item := range f.Enum {
+			if strings.TrimSpace(cast.ToString(item.Value)) == str {
+				matched = item.Value
+				break
 			}
 		}
+		normalised = append(normalised, matched)
 	}
 
-	a.RegisterField(f)
+	switch a.checkboxFormat {
+	case CheckboxFormatArray:
+		a.SetFieldData(f, normalised)
+	case CheckboxFormatObjects:
+		objects := []interface{}{}
+		for _, value := range normalised {
+			label, _ := f.GetEnumLabel(value)
+			objects = append(objects, map[string]interface{}{"value": value, "text": label})
+		}
+		a.SetFieldData(f, objects)
+	case CheckboxFormatString:
+		a.SetFieldData(f, strings.Join(cast.ToStringSlice(normalised), ","))
+	}
+}
+
+// GetMaxItems returns the maxItems of an array field, or -1 when there is no limit
+func (f *Field) GetMaxItems() (int, error) {
+	if !f.Schema.Exists("maxItems") {
+		return -1, nil
+	}
+
+	maxItems, err := cast.ToIntE(f.Schema.S("maxItems").Data())
+	if err != nil || maxItems < 0 {
+		return 0, NewFieldError(f, ErrMaxItemsInvalid)
+	}
+	return maxItems, nil
 }
 
 // Tag control field
@@ -74,25 +122,33 @@ func (a *Alpaca) Tag(f *Field) {
 }
 
 // Object container field
-func (a *Alpaca) Object(f *Field) {
+func (a *Alpaca) Object(f *Field) error {
 	f.IsContainerField = true
 
-	properties, err := f.Schema.S("properties").ChildrenMap()
-	if err == nil {
-		for key := range properties {
-			a.ResolvePropertySchemaOptions(key, f)
+	properties := f.Schema.S("properties")
+	if _, err := properties.ChildrenMap(); err == nil {
+		for _, key := range a.order.keys(properties) {
+			if err := a.ResolvePropertySchemaOptions(key, f); err != nil {
+				return err
+			}
 		}
 	}
+	a.ResolveAdditionalProperties(f)
 	a.RegisterField(f)
+	return nil
 }
 
 // Camera container field
-func (a *Alpaca) Camera(f *Field) {
+func (a *Alpaca) Camera(f *Field) error {
 	if a.request != nil {
 
 		maxImage := 10
 		if f.Schema.Exists("maxImage") {
-			maxImage = f.Schema.S("maxItems").Data().(int)
+			var err error
+			maxImage, err = cast.ToIntE(f.Schema.S("maxImage").Data())
+			if err != nil || maxImage < 0 {
+				return NewFieldError(f, ErrMaxImageInvalid)
+			}
 		}
 
 		for x := 0; x < maxImage; x++ {
@@ -101,6 +157,7 @@ func (a *Alpaca) Camera(f *Field) {
 	}
 
 	a.RegisterField(f)
+	return nil
 }
 
 // Information container field
@@ -121,17 +178,41 @@ func (a *Alpaca) Signature(f *Field) {
 
 // Datetime control field
 func (a *Alpaca) Datetime(f *Field) {
-	str := cast.ToString(f.Data.Data())
-	layout := "2006-01-02T15:04:05.000"
-	t, err := time.Parse(layout, str)
-	if err != nil {
-		f.Value = f.Data.Data()
-	} else {
-		f.Value = t.Format("2006-01-02 03:04:05")
-	}
+	a.NormaliseTimeField(f, "datetime", a.dateTime.DateTimeFormat, "2006-01-02 15:04:05")
 	a.RegisterField(f)
 }
 
+// Date control field
+func (a *Alpaca) Date(f *Field) {
+	a.NormaliseTimeField(f, "date", a.dateTime.DateFormat, "2006-01-02")
+	a.RegisterField(f)
+}
+
+// Time control field
+func (a *Alpaca) Time(f *Field) {
+	a.NormaliseTimeField(f, "time", a.dateTime.TimeFormat, "15:04:05")
+	a.RegisterField(f)
+}
+
+// NormaliseTimeField rewrites the value of a date, time or datetime field in its canonical format when normalisation is on.
+// Values that match none of the accepted layouts are left as submitted.
+func (a *Alpaca) NormaliseTimeField(f *Field, kind string, format string, fallback string) {
+	f.Value = f.Data.Data()
+
+	str, ok := f.Value.(string)
+	if !ok || str == "" || !a.dateTime.Normalise {
+		return
+	}
+
+	if format == "" {
+		format = fallback
+	}
+
+	if normalised, ok := NormaliseTime(str, a.GetTimeLayouts(f, kind), format, a.location); ok {
+		f.Value = normalised
+	}
+}
+
 // Any control field
 func (a *Alpaca) Any(f *Field) {
 	a.RegisterField(f)
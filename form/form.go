@@ -0,0 +1,304 @@
+// Package form builds alpaca forms in code rather than by concatenating JSON
+package form
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/GeorgeD19/alpaca-go"
+)
+
+// Field assembles the schema and options of a field. Build the root object to get the document
+// AlpacaOptions.Schema expects.
+//
+//	form.Object().Prop("location", form.Radio("Location").Enum("External", "Internal").Order(3))
+type Field struct {
+	schema     alpaca.OrderedObject
+	options    alpaca.OrderedObject
+	properties []property
+	items      *Field
+	depends    alpaca.OrderedObject
+}
+
+// property is a property of an object, kept in the order it was added
+type property struct {
+	Key   string
+	Field *Field
+}
+
+// New starts a field of a schema type, shown as a field type when it is not empty
+func New(schemaType string, fieldType string) *Field {
+	b := &Field{}
+	b.schema.Set("type", schemaType)
+	if fieldType != "" {
+		b.options.Set("type", fieldType)
+	}
+	return b
+}
+
+// Object starts an object, its properties added with Prop
+func Object() *Field {
+	return New("object", "")
+}
+
+// Repeatable starts an array shown as a repeatable of items
+func Repeatable(title string, item *Field) *Field {
+	return New("array", "repeatable").Title(title).Items(item)
+}
+
+// Text starts a text field
+func Text(title string) *Field {
+	return New("string", "text").Title(title)
+}
+
+// TextArea starts a multi-line text field
+func TextArea(title string) *Field {
+	return New("string", "textarea").Title(title)
+}
+
+// Number starts a number field
+func Number(title string) *Field {
+	return New("number", "number").Title(title)
+}
+
+// Radio starts a radio field, its choices set with Enum
+func Radio(title string) *Field {
+	return New("string", "radio").Title(title)
+}
+
+// Select starts a select field, its choices set with Enum
+func Select(title string) *Field {
+	return New("string", "select").Title(title)
+}
+
+// Checkbox starts a checkbox field, a single tick box unless its choices are set with Enum
+func Checkbox(title string) *Field {
+	return New("boolean", "checkbox").Title(title)
+}
+
+// Date starts a date field
+func Date(title string) *Field {
+	return New("string", "date").Title(title).Format("date")
+}
+
+// DateTime starts a date and time field
+func DateTime(title string) *Field {
+	return New("string", "datetime").Title(title).Format("datetime")
+}
+
+// Time starts a time field
+func Time(title string) *Field {
+	return New("string", "time").Title(title).Format("time")
+}
+
+// Camera starts a camera field, its photos arriving with the request
+func Camera(title string) *Field {
+	return New("string", "camera").Title(title)
+}
+
+// Signature starts a signature field
+func Signature(title string) *Field {
+	return New("string", "signature").Title(title)
+}
+
+// Title sets the title of the field
+func (b *Field) Title(title string) *Field {
+	return b.Schema("title", title)
+}
+
+// Format sets the schema format of the field
+func (b *Field) Format(format string) *Field {
+	return b.Schema("format", format)
+}
+
+// Required marks the field as required
+func (b *Field) Required() *Field {
+	return b.Schema("required", true)
+}
+
+// ReadOnly marks the field as read only
+func (b *Field) ReadOnly() *Field {
+	return b.Schema("readonly", true)
+}
+
+// Default sets the default value of the field
+func (b *Field) Default(value interface{}) *Field {
+	return b.Schema("default", value)
+}
+
+// MaxItems limits how many items an array holds
+func (b *Field) MaxItems(maxItems int) *Field {
+	return b.Schema("maxItems", maxItems)
+}
+
+// Order sets the position of the field among its siblings
+func (b *Field) Order(order float64) *Field {
+	return b.Option("order", order)
+}
+
+// Enum sets the choices of the field. Checkboxes with choices hold an array of them.
+func (b *Field) Enum(values ...interface{}) *Field {
+	if b.options.Values["type"] == "checkbox" {
+		if b.items == nil {
+			b.items = New("string", "")
+		}
+		b.schema.Set("type", "array")
+		b.items.Schema("enum", values)
+		return b
+	}
+	return b.Schema("enum", values)
+}
+
+// OptionLabels sets the labels shown for the choices of the field
+func (b *Field) OptionLabels(labels ...string) *Field {
+	return b.Option("optionLabels", labels)
+}
+
+// Schema sets an attribute of the field's schema
+func (b *Field) Schema(key string, value interface{}) *Field {
+	b.schema.Set(key, value)
+	return b
+}
+
+// Option sets an attribute of the field's options
+func (b *Field) Option(key string, value interface{}) *Field {
+	b.options.Set(key, value)
+	return b
+}
+
+// Prop adds a property to an object. Properties keep the order they were added in.
+func (b *Field) Prop(key string, field *Field) *Field {
+	b.properties = append(b.properties, property{Key: key, Field: field})
+	return b
+}
+
+// Items sets the schema of the items of an array
+func (b *Field) Items(item *Field) *Field {
+	b.items = item
+	return b
+}
+
+// DependsOn shows the field only when a sibling property holds one of values, or any value when none are given
+func (b *Field) DependsOn(key string, values ...interface{}) *Field {
+	if values == nil {
+		values = []interface{}{}
+	}
+	b.depends.Set(key, values)
+	return b
+}
+
+// Build returns the form as the {"schema":...,"options":...} document AlpacaOptions.Schema expects,
+// checking it is one alpaca can parse
+func (b *Field) Build() (string, error) {
+	schema, options, err := b.build("")
+	if err != nil {
+		return "", err
+	}
+
+	document := alpaca.OrderedObject{}
+	document.Set("schema", schema)
+	document.Set("options", options)
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := alpaca.New(alpaca.AlpacaOptions{Schema: string(encoded), Data: "{}"}); err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// build returns the schema and options of the field at a schema path
+func (b *Field) build(path string) (alpaca.OrderedObject, alpaca.OrderedObject, error) {
+	schema := copyObject(b.schema)
+	options := copyObject(b.options)
+
+	enum, _ := schema.Values["enum"].([]interface{})
+	if b.items != nil {
+		enum, _ = b.items.schema.Values["enum"].([]interface{})
+	}
+	if labels, ok := options.Values["optionLabels"].([]string); ok && len(labels) != len(enum) {
+		return schema, options, &alpaca.FieldError{Path: path, Err: alpaca.ErrOptionLabelsInvalid}
+	}
+
+	if len(b.depends.Keys) > 0 {
+		dependencies := alpaca.OrderedObject{}
+		for _, key := range b.depends.Keys {
+			if values := b.depends.Values[key].([]interface{}); len(values) > 0 {
+				dependencies.Set(key, values)
+			}
+		}
+		if len(dependencies.Keys) > 0 {
+			options.Set("dependencies", dependencies)
+		}
+	}
+
+	switch schema.Values["type"] {
+	case "object":
+		properties := alpaca.OrderedObject{}
+		fields := alpaca.OrderedObject{}
+		dependencies := alpaca.OrderedObject{}
+		for _, property := range b.properties {
+			propertyPath := alpaca.JoinPath(path, property.Key)
+			if property.Key == "" || strings.ContainsAny(property.Key, ".[]") || property.Field == nil {
+				return schema, options, &alpaca.FieldError{Path: propertyPath, Err: alpaca.ErrPropertyInvalid}
+			}
+			if _, exists := properties.Values[property.Key]; exists {
+				return schema, options, &alpaca.FieldError{Path: propertyPath, Err: alpaca.ErrPropertyDuplicate}
+			}
+
+			propertySchema, propertyOptions, err := property.Field.build(propertyPath)
+			if err != nil {
+				return schema, options, err
+			}
+			properties.Set(property.Key, propertySchema)
+			if len(propertyOptions.Keys) > 0 {
+				fields.Set(property.Key, propertyOptions)
+			}
+			if len(property.Field.depends.Keys) > 0 {
+				dependencies.Set(property.Key, property.Field.depends.Keys)
+			}
+		}
+
+		// Dependencies are checked once every sibling is known, as they may come later
+		for _, key := range dependencies.Keys {
+			for _, dependency := range dependencies.Values[key].([]string) {
+				if _, exists := properties.Values[dependency]; !exists || dependency == key {
+					return schema, options, &alpaca.FieldError{Path: alpaca.JoinPath(path, key), Err: alpaca.ErrDependencyInvalid}
+				}
+			}
+		}
+
+		schema.Set("properties", properties)
+		if len(dependencies.Keys) > 0 {
+			schema.Set("dependencies", dependencies)
+		}
+		if len(fields.Keys) > 0 {
+			options.Set("fields", fields)
+		}
+	case "array":
+		if b.items == nil {
+			return schema, options, &alpaca.FieldError{Path: path, Err: alpaca.ErrItemsMissing}
+		}
+		itemSchema, itemOptions, err := b.items.build(path + "[]")
+		if err != nil {
+			return schema, options, err
+		}
+		schema.Set("items", itemSchema)
+		if len(itemOptions.Keys) > 0 {
+			options.Set("items", itemOptions)
+		}
+	}
+
+	return schema, options, nil
+}
+
+// copyObject returns a shallow copy of an ordered object
+func copyObject(o alpaca.OrderedObject) alpaca.OrderedObject {
+	copied := alpaca.OrderedObject{}
+	for _, key := range o.Keys {
+		copied.Set(key, o.Values[key])
+	}
+	return copied
+}
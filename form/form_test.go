@@ -0,0 +1,61 @@
+package form
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GeorgeD19/alpaca-go"
+)
+
+func TestBuild(t *testing.T) {
+	built := Object().
+		Prop("site", Text("Site").Required().Order(1)).
+		Prop("location", Radio("Location").Enum("External", "Internal").OptionLabels("Outside", "Inside").Order(3)).
+		Prop("hazards", Checkbox("Hazards").Enum("Fire", "Flood").DependsOn("location", "External")).
+		Prop("list_of_electrical", Repeatable("Devices", Object().
+			Prop("electrical_device", Text("Device")).
+			Prop("photo", Camera("Photo"))).MaxItems(10).DependsOn("location", "Internal"))
+
+	result, err := built.Build()
+	if err != nil {
+		t.Fatalf("TestBuild error: %s", err)
+	}
+	expected := `{"schema":{"type":"object","properties":{"site":{"type":"string","title":"Site","required":true},"location":{"type":"string","title":"Location","enum":["External","Internal"]},"hazards":{"type":"array","title":"Hazards","items":{"type":"string","enum":["Fire","Flood"]}},"list_of_electrical":{"type":"array","title":"Devices","maxItems":10,"items":{"type":"object","properties":{"electrical_device":{"type":"string","title":"Device"},"photo":{"type":"string","title":"Photo"}}}}},"dependencies":{"hazards":["location"],"list_of_electrical":["location"]}},"options":{"fields":{"site":{"type":"text","order":1},"location":{"type":"radio","optionLabels":["Outside","Inside"],"order":3},"hazards":{"type":"checkbox","dependencies":{"location":["External"]}},"list_of_electrical":{"type":"repeatable","dependencies":{"location":["Internal"]},"items":{"fields":{"electrical_device":{"type":"text"},"photo":{"type":"camera"}}}}}}}`
+	if result != expected {
+		t.Fatalf(`Should return %s, instead returned %s`, expected, result)
+	}
+
+	parsed, err := alpaca.New(alpaca.AlpacaOptions{Schema: result, Data: `{"location":"Internal","list_of_electrical":[{"electrical_device":"Kettle"}]}`})
+	if err != nil {
+		t.Fatalf("TestBuild error: %s", err)
+	}
+	if f := parsed.FieldByPath("list_of_electrical[0].photo"); f == nil || f.Type != "camera" {
+		t.Fatalf(`Should return camera field, instead returned %v`, f)
+	}
+
+	// Repeatables without MaxItems hold any number of items
+	unlimited, err := Object().Prop("list", Repeatable("List", Object().Prop("name", Text("Name")))).Build()
+	if err != nil {
+		t.Fatalf("TestBuild error: %s", err)
+	}
+	parsed, err = alpaca.New(alpaca.AlpacaOptions{Schema: unlimited, Data: `{"list":[{"name":"a"},{"name":"b"},{"name":"c"}]}`})
+	if err != nil {
+		t.Fatalf("TestBuild error: %s", err)
+	}
+	if result := parsed.Parse(); result != `{"list":[{"name":"a"},{"name":"b"},{"name":"c"}]}` {
+		t.Fatalf(`Should return {"list":[{"name":"a"},{"name":"b"},{"name":"c"}]}, instead returned %s`, result)
+	}
+
+	if _, err := Object().Prop("comments", Text("Comments").DependsOn("missing")).Build(); !errors.Is(err, alpaca.ErrDependencyInvalid) {
+		t.Fatalf(`Should return ErrDependencyInvalid, instead returned %v`, err)
+	}
+	if _, err := Object().Prop("site", Text("Site")).Prop("site", Text("Site")).Build(); !errors.Is(err, alpaca.ErrPropertyDuplicate) {
+		t.Fatalf(`Should return ErrPropertyDuplicate, instead returned %v`, err)
+	}
+	if _, err := Object().Prop("list", Repeatable("List", nil)).Build(); !errors.Is(err, alpaca.ErrItemsMissing) {
+		t.Fatalf(`Should return ErrItemsMissing, instead returned %v`, err)
+	}
+	if _, err := Object().Prop("location", Radio("Location").Enum("External").OptionLabels("Outside", "Inside")).Build(); !errors.Is(err, alpaca.ErrOptionLabelsInvalid) {
+		t.Fatalf(`Should return ErrOptionLabelsInvalid, instead returned %v`, err)
+	}
+}
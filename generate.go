@@ -0,0 +1,316 @@
+package alpaca
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cast"
+)
+
+// GenerateOptions configures GenerateGo
+type GenerateOptions struct {
+	// Package names the package of the generated file
+	Package string
+	// Type names the struct generated for the form, prefixing the names of every type generated for its fields
+	Type string
+	// Command is named in the generated file's header, defaulting to alpaca-gen
+	Command string
+	// RefLoader loads the documents $refs point into other than the form itself
+	RefLoader RefLoader
+}
+
+// GenerateGo returns a Go source file declaring a struct for the answers of a form, tagged for Decode.
+// Objects and repeatable items become structs of their own, repeatables slices of them, string enums
+// typed constants with their labels and camera and signature fields Media. Arrays keep their maxItems as a tag.
+//
+// It also declares a Fields type per struct giving typed access to the registered fields of a parsed form.
+func GenerateGo(schema string, options GenerateOptions) ([]byte, error) {
+	if options.Type == "" || !isIdentifier(options.Type) || options.Package == "" || !isIdentifier(options.Package) {
+		return nil, ErrGenerateInvalid
+	}
+	if options.Command == "" {
+		options.Command = "alpaca-gen"
+	}
+
+	skeleton, err := NewSkeleton(schema, 1, options.RefLoader)
+	if err != nil {
+		return nil, err
+	}
+	var root *Field
+	for _, f := range skeleton.FieldRegistry {
+		if f.Parent == nil {
+			root = f
+			break
+		}
+	}
+	if root == nil || root.Schema.S("type").Data() != "object" {
+		return nil, ErrGenerateInvalid
+	}
+
+	g := &generator{names: map[string]bool{"New" + options.Type + "Fields": true}}
+	g.generateStruct(options.Type, root, "the form")
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "// Code generated by %s. DO NOT EDIT.\n\npackage %s\n\n", options.Command, options.Package)
+	buffer.WriteString("import (\n")
+	if g.usesStrconv {
+		buffer.WriteString("\t\"strconv\"\n")
+	}
+	if g.usesTime {
+		buffer.WriteString("\t\"time\"\n")
+	}
+	if g.usesStrconv || g.usesTime {
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString("\t\"github.com/GeorgeD19/alpaca-go\"\n)\n")
+	for _, declaration := range g.declarations {
+		buffer.WriteString("\n")
+		buffer.WriteString(declaration)
+	}
+
+	fmt.Fprintf(buffer, "\n// New%[1]sFields gives typed access to the fields of a parsed form\n", options.Type)
+	fmt.Fprintf(buffer, "func New%[1]sFields(form *alpaca.Alpaca) %[1]sFields {\n\treturn %[1]sFields{Form: form}\n}\n", options.Type)
+	fmt.Fprintf(buffer, "\n// Decode returns the answers of the form\n")
+	fmt.Fprintf(buffer, "func (f %[1]sFields) Decode() (%[1]s, error) {\n\tvar answers %[1]s\n\terr := alpaca.Decode(f.Form, &answers)\n\treturn answers, err\n}\n", options.Type)
+
+	return format.Source(buffer.Bytes())
+}
+
+// generator collects the declarations of a generated file, naming every type once
+type generator struct {
+	declarations []string
+	names        map[string]bool
+	usesTime     bool
+	usesStrconv  bool
+}
+
+// generatedField is a struct field generated for a property
+type generatedField struct {
+	Name     string
+	Type     string
+	Key      string
+	Field    *Field
+	Fields   string
+	Item     string
+	ItemName string
+}
+
+// reservedNames are taken by the fields and methods every Fields type has
+var reservedNames = []string{"Form", "Path", "Decode"}
+
+// uniqueName returns name, numbered when it is already taken, and takes it
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	names[unique] = true
+	return unique
+}
+
+// typeName reserves a type name, numbering it when it is already taken
+func (g *generator) typeName(name string) string {
+	return uniqueName(g.names, name)
+}
+
+// generateStruct declares a struct and its Fields type for an object field, returning the struct's name
+func (g *generator) generateStruct(name string, object *Field, description string) string {
+	// The struct and its Fields type are numbered together
+	unique := name
+	for i := 2; g.names[unique] || g.names[unique+"Fields"]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	name = unique
+	g.names[name] = true
+	g.names[name+"Fields"] = true
+	index := len(g.declarations)
+	g.declarations = append(g.declarations, "")
+
+	// Struct fields share their names with the accessors of the Fields type, which must not clash with its own
+	fields := []generatedField{}
+	names := map[string]bool{}
+	for _, reserved := range reservedNames {
+		names[reserved] = true
+	}
+	for _, child := range object.Children {
+		if child.SharesParentData() {
+			continue
+		}
+		field := generatedField{Name: uniqueName(names, goName(child.Key)), Key: child.Key, Field: child}
+		field.Type = g.fieldType(name+field.Name, child, &field)
+		if field.Item != "" {
+			field.ItemName = uniqueName(names, field.Name+"Item")
+		}
+		fields = append(fields, field)
+	}
+
+	declaration := new(bytes.Buffer)
+	fmt.Fprintf(declaration, "// %s holds the answers of %s\n", name, description)
+	fmt.Fprintf(declaration, "type %s struct {\n", name)
+	for _, field := range fields {
+		tag := "alpaca:" + strconv.Quote(field.Key)
+		if maxItems, err := cast.ToIntE(field.Field.Schema.S("maxItems").Data()); err == nil && field.Field.Schema.Exists("maxItems") {
+			tag += " maxItems:" + strconv.Quote(strconv.Itoa(maxItems))
+		}
+		fmt.Fprintf(declaration, "\t%s %s `%s`\n", field.Name, field.Type, tag)
+	}
+	declaration.WriteString("}\n")
+
+	fmt.Fprintf(declaration, "\n// %sFields gives typed access to the registered fields of %s\n", name, description)
+	fmt.Fprintf(declaration, "type %sFields struct {\n\tForm *alpaca.Alpaca\n\tPath string\n}\n", name)
+	for _, field := range fields {
+		path := "alpaca.JoinPath(f.Path, " + strconv.Quote(field.Key) + ")"
+		if field.Fields != "" {
+			fmt.Fprintf(declaration, "\n// %s returns the fields of %s\n", field.Name, describe(field.Field, field.Key))
+			fmt.Fprintf(declaration, "func (f %sFields) %s() %s {\n\treturn %s{Form: f.Form, Path: %s}\n}\n", name, field.Name, field.Fields, field.Fields, path)
+			continue
+		}
+		fmt.Fprintf(declaration, "\n// %s returns the %s field, or nil when it is not registered\n", field.Name, field.Key)
+		fmt.Fprintf(declaration, "func (f %sFields) %s() *alpaca.Field {\n\treturn f.Form.FieldByPath(%s)\n}\n", name, field.Name, path)
+		if field.Item != "" {
+			g.usesStrconv = true
+			fmt.Fprintf(declaration, "\n// %s returns the fields of item i of %s\n", field.ItemName, field.Key)
+			fmt.Fprintf(declaration, "func (f %sFields) %s(i int) %s {\n\treturn %s{Form: f.Form, Path: %s + \"[\" + strconv.Itoa(i) + \"]\"}\n}\n", name, field.ItemName, field.Item, field.Item, path)
+		}
+	}
+
+	g.declarations[index] = declaration.String()
+	return name
+}
+
+// fieldType returns the Go type of a field's answers, declaring the types it needs
+func (g *generator) fieldType(name string, f *Field, field *generatedField) string {
+	switch f.Type {
+	case "camera", "signature":
+		return "alpaca.Media"
+	}
+
+	schemaType, _ := f.Schema.S("type").Data().(string)
+	enum := f.GetEnumSchema()
+	switch schemaType {
+	case "object":
+		structName := g.generateStruct(name, f, describe(f, f.Key))
+		field.Fields = structName + "Fields"
+		return structName
+	case "array":
+		if enum != nil {
+			itemType, _ := f.Schema.S("items", "type").Data().(string)
+			return "[]" + g.enumType(name, f, itemType)
+		}
+		if len(f.Children) == 0 {
+			return "[]interface{}"
+		}
+		item := f.Children[0]
+		if item.Schema.S("type").Data() == "object" {
+			structName := g.generateStruct(name, item, "an item of "+describe(f, f.Key))
+			field.Item = structName + "Fields"
+			return "[]" + structName
+		}
+		return "[]" + g.fieldType(name+"Item", item, &generatedField{})
+	}
+
+	switch f.Type {
+	case "date", "datetime", "time":
+		g.usesTime = true
+		return "time.Time"
+	}
+	if enum != nil {
+		return g.enumType(name, f, schemaType)
+	}
+	return scalarGoType(schemaType)
+}
+
+// enumType declares a string type with a constant per enum value, or returns the Go type of non-string enums
+func (g *generator) enumType(name string, f *Field, schemaType string) string {
+	values, _ := f.GetEnumSchema().Data().([]interface{})
+	if schemaType != "string" && schemaType != "array" && schemaType != "" {
+		return scalarGoType(schemaType)
+	}
+	for _, value := range values {
+		if _, ok := value.(string); !ok {
+			return "interface{}"
+		}
+	}
+
+	name = g.typeName(name)
+	declaration := new(bytes.Buffer)
+	fmt.Fprintf(declaration, "// %s is a choice of %s\n", name, describe(f, f.Key))
+	fmt.Fprintf(declaration, "type %s string\n\n", name)
+
+	constants := []string{}
+	if len(values) > 0 {
+		fmt.Fprintf(declaration, "// Choices of %s\nconst (\n", describe(f, f.Key))
+		for _, value := range values {
+			constant := g.typeName(name + goName(value.(string)))
+			constants = append(constants, constant)
+			fmt.Fprintf(declaration, "\t%s %s = %s\n", constant, name, strconv.Quote(value.(string)))
+		}
+		declaration.WriteString(")\n\n")
+	}
+
+	fmt.Fprintf(declaration, "// Label returns the label shown for the choice\n")
+	fmt.Fprintf(declaration, "func (v %s) Label() string {\n\tswitch v {\n", name)
+	for i, value := range values {
+		label, _ := f.GetEnumLabel(value)
+		fmt.Fprintf(declaration, "\tcase %s:\n\t\treturn %s\n", constants[i], strconv.Quote(label))
+	}
+	declaration.WriteString("\t}\n\treturn string(v)\n}\n")
+
+	g.declarations = append(g.declarations, declaration.String())
+	return name
+}
+
+// scalarGoType returns the Go type of a schema type
+func scalarGoType(schemaType string) string {
+	switch schemaType {
+	case "string":
+		return "string"
+	case "number":
+		return "float64"
+	case "integer":
+		return "int"
+	case "boolean":
+		return "bool"
+	}
+	return "interface{}"
+}
+
+// describe returns the title of a field, or fallback when it has none
+func describe(f *Field, fallback string) string {
+	if title, ok := f.Schema.S("title").Data().(string); ok && strings.TrimSpace(title) != "" {
+		return strings.Join(strings.Fields(title), " ")
+	}
+	return fallback
+}
+
+// goName returns an exported Go identifier for a property key or enum value, e.g. list_of_electrical becomes ListOfElectrical
+func goName(key string) string {
+	name := ""
+	for _, word := range strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(word)
+		name += string(unicode.ToUpper(runes[0])) + string(runes[1:])
+	}
+	if name == "" {
+		return "Empty"
+	}
+	if !unicode.IsLetter([]rune(name)[0]) {
+		name = "N" + name
+	}
+	return name
+}
+
+// isIdentifier reports whether a name is a valid Go identifier
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
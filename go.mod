@@ -1,6 +1,6 @@
 module github.com/GeorgeD19/alpaca-go
 
-go 1.13
+go 1.18
 
 require (
 	github.com/Jeffail/gabs v1.4.0
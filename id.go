@@ -0,0 +1,75 @@
+package alpaca
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/spf13/cast"
+)
+
+// IDStrategy decides how field IDs are generated
+type IDStrategy string
+
+const (
+	// IDStrategyHash derives IDs from the schema path of the field and the identity of any array items it is in.
+	// Items are identified by the property named in the array's itemKey option, or by their position.
+	IDStrategyHash IDStrategy = ""
+	// IDStrategySequential numbers fields alpaca1, alpaca2 and so on in the order they are created, as Alpaca does
+	IDStrategySequential IDStrategy = "sequential"
+)
+
+// GetFieldID returns a unique ID for a field according to the configured strategy
+func (a *Alpaca) GetFieldID(f *Field) string {
+	id := ""
+	if a.idStrategy == IDStrategySequential {
+		a.UniqueIDCounter++
+		id = "alpaca" + strconv.Itoa(a.UniqueIDCounter)
+	} else {
+		hash := sha1.New()
+		for _, part := range f.GetIdentity() {
+			hash.Write([]byte(part))
+			hash.Write([]byte{0})
+		}
+		id = "alpaca" + hex.EncodeToString(hash.Sum(nil))[:12]
+	}
+
+	// Items sharing an itemKey or their parent's data would otherwise collide
+	if a.ids == nil {
+		a.ids = map[string]bool{}
+	}
+	unique := id
+	for i := 2; a.ids[unique]; i++ {
+		unique = id + "-" + strconv.Itoa(i)
+	}
+	a.ids[unique] = true
+
+	return unique
+}
+
+// GetIdentity returns the parts identifying a field, independently of the position of the array items it is in
+// when they have an itemKey. Answers are never part of it, so editing them keeps the IDs.
+func (f *Field) GetIdentity() []string {
+	if f.Parent == nil {
+		return []string{}
+	}
+
+	identity := f.Parent.GetIdentity()
+	if f.SharesParentData() {
+		return identity
+	}
+	if !f.IsArrayItem() {
+		return append(identity, "."+f.Key)
+	}
+
+	if f.Parent.Options.Exists("itemKey") {
+		itemKey := cast.ToString(f.Parent.Options.S("itemKey").Data())
+		if f.Data.Exists(itemKey) {
+			if key := cast.ToString(f.Data.S(itemKey).Data()); key != "" {
+				return append(identity, "[key:"+key+"]")
+			}
+		}
+	}
+
+	return append(identity, "["+strconv.Itoa(f.ArrayIndex)+"]")
+}
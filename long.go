@@ -0,0 +1,93 @@
+package alpaca
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Answer is one answer of a submission in long format. The schema path is shared by the answers
+// of every item of a repeatable, which ArrayIndex tells apart.
+type Answer struct {
+	SubmissionID string      `json:"submission_id"`
+	Path         string      `json:"path"`
+	SchemaPath   string      `json:"schema_path"`
+	Title        string      `json:"title"`
+	Type         string      `json:"type"`
+	Value        interface{} `json:"value"`
+	Label        string      `json:"label"`
+	// ArrayIndex is the index of the item of the closest repeatable, nil outside repeatables
+	ArrayIndex *int `json:"array_index"`
+}
+
+// LongColumns are the columns of long format CSV
+var LongColumns = []string{"submission_id", "path", "schema_path", "title", "type", "value", "label", "array_index"}
+
+// Answers returns a record for each submitted answer in form order
+func (a *Alpaca) Answers(submissionID string) []Answer {
+	answers := []Answer{}
+	for _, f := range a.FieldRegistry {
+		if !f.IsExportLeaf() || !f.IsSubmitted() {
+			continue
+		}
+
+		answer := Answer{
+			SubmissionID: submissionID,
+			Path:         f.PathString,
+			SchemaPath:   f.GetSchemaPath(),
+			Title:        f.Title,
+			Type:         f.Type,
+			Value:        f.Value,
+			Label:        f.DisplayValue(false),
+		}
+		if item := f.GetRepeatableItem(); item != nil {
+			index := item.ArrayIndex
+			answer.ArrayIndex = &index
+		}
+		answers = append(answers, answer)
+	}
+	return answers
+}
+
+// WriteNDJSON writes the answers of submissions as one JSON object per line
+func WriteNDJSON(w io.Writer, submissions []Submission) error {
+	encoder := json.NewEncoder(w)
+	for _, submission := range submissions {
+		for _, answer := range submission.Form.Answers(submission.ID) {
+			if err := encoder.Encode(answer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteLongCSV writes the answers of submissions as CSV with one row per answer
+func WriteLongCSV(w io.Writer, submissions []Submission) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(LongColumns); err != nil {
+		return err
+	}
+
+	for _, submission := range submissions {
+		for _, answer := range submission.Form.Answers(submission.ID) {
+			index := ""
+			if answer.ArrayIndex != nil {
+				index = strconv.Itoa(*answer.ArrayIndex)
+			}
+			record := []string{answer.SubmissionID, answer.Path, answer.SchemaPath, answer.Title, answer.Type, ExportString(answer.Value), answer.Label, index}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		// Flush per submission so long exports stream rather than buffer
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
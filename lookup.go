@@ -0,0 +1,171 @@
+package alpaca
+
+import (
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// indexFields rebuilds the path indexes used by FieldByPath, FieldByPointer and FieldByJSONPath
+func (a *Alpaca) indexFields() {
+	a.fieldIndex = make(map[string]*Field, len(a.FieldRegistry))
+	a.pointerIndex = make(map[string]*Field, len(a.FieldRegistry))
+	for _, f := range a.FieldRegistry {
+		if _, exists := a.fieldIndex[f.PathString]; !exists {
+			a.fieldIndex[f.PathString] = f
+		}
+		// Items sharing their parent's data have the same pointer, prefer the outermost field
+		if existing, exists := a.pointerIndex[f.Pointer]; !exists || len(f.SortKey) < len(existing.SortKey) {
+			a.pointerIndex[f.Pointer] = f
+		}
+	}
+}
+
+// FieldByPath returns the field registered at a path such as list_of_electrical[2].electrical_device, or nil
+func (a *Alpaca) FieldByPath(path string) *Field {
+	if a.fieldIndex == nil {
+		a.indexFields()
+	}
+	return a.fieldIndex[path]
+}
+
+// Fields returns the fields whose path matches a glob in registry order.
+// A * matches within a single path segment, ** matches across segments and ? matches any one character.
+func (a *Alpaca) Fields(glob string) []*Field {
+	fields := []*Field{}
+	for _, f := range a.FieldRegistry {
+		if MatchPath(glob, f.PathString) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// MatchPath reports whether a path string matches a glob as used by Fields
+func MatchPath(glob string, path string) bool {
+	if glob == "" {
+		return path == ""
+	}
+
+	switch glob[0] {
+	case '*':
+		if len(glob) > 1 && glob[1] == '*' {
+			for i := 0; i <= len(path); i++ {
+				if MatchPath(glob[2:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		for i := 0; i <= len(path); i++ {
+			if MatchPath(glob[1:], path[i:]) {
+				return true
+			}
+			if i < len(path) && (path[i] == '.' || path[i] == '[' || path[i] == ']') {
+				return false
+			}
+		}
+		return false
+	case '?':
+		return path != "" && MatchPath(glob[1:], path[1:])
+	}
+
+	return path != "" && glob[0] == path[0] && MatchPath(glob[1:], path[1:])
+}
+
+// Walk visits the field tree depth first in form order, stopping at the first error
+func (a *Alpaca) Walk(fn func(*Field) error) error {
+	for _, f := range a.FieldRegistry {
+		if f.Parent == nil {
+			if err := f.Walk(fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Walk visits the field and its children depth first in form order, stopping at the first error
+func (f *Field) Walk(fn func(*Field) error) error {
+	if err := fn(f); err != nil {
+		return err
+	}
+	for _, child := range f.Children {
+		if err := child.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the value of the field as a string
+func (f *Field) String() string {
+	return cast.ToString(f.Value)
+}
+
+// Float returns the value of the field as a float64
+func (f *Field) Float() (float64, error) {
+	return cast.ToFloat64E(f.Value)
+}
+
+// Int returns the value of the field as an int
+func (f *Field) Int() (int, error) {
+	return cast.ToIntE(f.Value)
+}
+
+// Bool returns the value of the field as a bool, accepting the same values as coercion
+func (f *Field) Bool() (bool, error) {
+	value, err := CoerceValue(f.Value, "boolean")
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+// Time returns the value of a date, time or datetime field as a time in the form's timezone
+func (f *Field) Time() (time.Time, error) {
+	str, ok := f.Value.(string)
+	if !ok {
+		return time.Time{}, ErrTimeInvalid
+	}
+	return f.ParseTime(str)
+}
+
+// ParseTime parses a value in the formats and timezone of the field's form
+func (f *Field) ParseTime(str string) (time.Time, error) {
+	location := time.UTC
+	layouts := []string{"2006-01-02 15:04:05", "2006-01-02", "15:04:05"}
+	if f.alpaca != nil {
+		if f.alpaca.location != nil {
+			location = f.alpaca.location
+		}
+		formats := f.alpaca.dateTime
+		layouts = append([]string{formats.DateTimeFormat, formats.DateFormat, formats.TimeFormat}, layouts...)
+		// Values kept as submitted are in one of the field's input layouts
+		switch f.Type {
+		case "date", "time", "datetime":
+			layouts = append(layouts, f.alpaca.GetTimeLayouts(f, f.Type)...)
+		}
+	}
+	layouts = append(layouts, DefaultDateTimeLayouts...)
+
+	for _, layout := range layouts {
+		if layout == "" {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, str, location); err == nil {
+			return t.In(location), nil
+		}
+	}
+
+	return time.Time{}, ErrTimeInvalid
+}
+
+// Strings returns the values of a multi-value field, or the single value of any other field, as strings
+func (f *Field) Strings() []string {
+	values := f.GetEnumValues()
+	if values == nil {
+		return nil
+	}
+	return cast.ToStringSlice(values)
+}
@@ -0,0 +1,236 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/Jeffail/gabs"
+)
+
+// dataSegment is one step from the root of the data to a field, either an object key or an array index
+type dataSegment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// IsArrayItem reports whether a field is an item of an array field rather than a property
+func (f *Field) IsArrayItem() bool {
+	if f.Parent == nil {
+		return false
+	}
+	switch f.Parent.Type {
+	case "array", "repeatable", "select", "checkbox":
+		return true
+	}
+	return false
+}
+
+// SharesParentData reports whether a field was resolved from its parent's own data, as array items without a schema are
+func (f *Field) SharesParentData() bool {
+	return f.Parent != nil && f.Parent.Key == f.Key && f.IsArrayItem() && !f.Parent.Schema.Exists("items")
+}
+
+// IsSubmitted reports whether the data holds a value for a field. Missing properties still resolve to an empty object.
+func (f *Field) IsSubmitted() bool {
+	if f.Parent == nil || f.SharesParentData() {
+		return f.Data.Data() != nil
+	}
+	if f.IsArrayItem() {
+		items, ok := f.Parent.Data.Data().([]interface{})
+		return ok && f.ArrayIndex < len(items)
+	}
+	return f.Parent.Data.Exists(f.Key)
+}
+
+// dataSegments returns the steps from the root of the data to a field
+func (f *Field) dataSegments() []dataSegment {
+	if f.Parent == nil {
+		return nil
+	}
+
+	segments := f.Parent.dataSegments()
+	if f.SharesParentData() {
+		return segments
+	}
+	if f.IsArrayItem() {
+		return append(segments, dataSegment{Index: f.ArrayIndex, IsIndex: true})
+	}
+	return append(segments, dataSegment{Key: f.Key})
+}
+
+// setIn returns node with value placed at the end of segments, creating any missing objects and arrays on the way
+func setIn(node interface{}, segments []dataSegment, value interface{}) interface{} {
+	if len(segments) == 0 {
+		return value
+	}
+
+	segment := segments[0]
+	if segment.IsIndex {
+		array, _ := node.([]interface{})
+		for len(array) <= segment.Index {
+			array = append(array, nil)
+		}
+		array[segment.Index] = setIn(array[segment.Index], segments[1:], value)
+		return array
+	}
+
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+	object[segment.Key] = setIn(object[segment.Key], segments[1:], value)
+	return object
+}
+
+// toData converts a Go value into the plain JSON data the parser works with
+func toData(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	container, err := gabs.ParseJSON(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return container.Data(), nil
+}
+
+// copyData returns a deep copy of plain JSON data, keeping the key order of its objects
+func (a *Alpaca) copyData(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			copied[key] = a.copyData(value)
+		}
+		if ordered, ok := a.order[reflect.ValueOf(v).Pointer()]; ok {
+			a.order.set(copied, ordered.keys)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, value := range v {
+			copied[i] = a.copyData(value)
+		}
+		return copied
+	}
+	return node
+}
+
+// setData writes a value into the data at a field's position and rebuilds the fields.
+// Fields obtained before the change are replaced and should be looked up again.
+// When the rebuild fails the data and fields are left as they were.
+func (a *Alpaca) setData(f *Field, value interface{}) error {
+	previous := *a
+	a.data, _ = gabs.Consume(setIn(a.copyData(a.data.Data()), f.dataSegments(), value))
+
+	// Keep what was coerced and enforced on the first pass, the data now holds the resulting values
+	coercions := a.Coercions
+	tamperEvents := a.TamperEvents
+	a.Coercions = nil
+	a.TamperEvents = nil
+	if err := a.build(); err != nil {
+		*a = previous
+		return err
+	}
+	a.Coercions = MergeCoercions(coercions, a.Coercions)
+	a.TamperEvents = append(tamperEvents, a.TamperEvents...)
+
+	return nil
+}
+
+// setServerData writes a value like setData, switching to new server values unless the rebuild fails
+func (a *Alpaca) setServerData(f *Field, value interface{}, serverValues map[string]interface{}) error {
+	previous := a.serverValues
+	a.serverValues = serverValues
+	if err := a.setData(f, value); err != nil {
+		a.serverValues = previous
+		return err
+	}
+	return nil
+}
+
+// SetValue replaces the value of the field at path and rebuilds the fields
+func (a *Alpaca) SetValue(path string, value interface{}) error {
+	f := a.FieldByPath(path)
+	if f == nil {
+		return &FieldError{Path: path, Err: ErrFieldNotFound}
+	}
+
+	data, err := toData(value)
+	if err != nil {
+		return &FieldError{Path: path, Pointer: f.Pointer, ID: f.ID, Err: err}
+	}
+
+	// Values set by the server are trusted, so protected fields keep them
+	if a.protect && f.IsProtected() {
+		values := map[string]interface{}{}
+		for pointer, value := range a.serverValues {
+			values[pointer] = value
+		}
+		values[f.Pointer] = data
+		return a.setServerData(f, data, values)
+	}
+
+	return a.setData(f, data)
+}
+
+// getItems returns the array field at path and a copy of its items
+func (a *Alpaca) getItems(path string) (*Field, []interface{}, error) {
+	f := a.FieldByPath(path)
+	if f == nil {
+		return nil, nil, &FieldError{Path: path, Err: ErrFieldNotFound}
+	}
+
+	switch f.Type {
+	case "array", "repeatable", "select", "checkbox":
+	default:
+		return nil, nil, &FieldError{Path: path, Pointer: f.Pointer, ID: f.ID, Err: ErrNotArray}
+	}
+
+	items := []interface{}{}
+	if current, ok := f.Data.Data().([]interface{}); ok {
+		items = append(items, current...)
+	}
+	return f, items, nil
+}
+
+// AppendItem adds an item to the end of the array field at path and rebuilds the fields
+func (a *Alpaca) AppendItem(path string, value interface{}) error {
+	f, items, err := a.getItems(path)
+	if err != nil {
+		return err
+	}
+
+	maxItems, err := f.GetMaxItems()
+	if err != nil {
+		return err
+	}
+	if maxItems >= 0 && len(items) >= maxItems {
+		return &FieldError{Path: path, Pointer: f.Pointer, ID: f.ID, Err: ErrMaxItemsExceeded}
+	}
+
+	data, err := toData(value)
+	if err != nil {
+		return &FieldError{Path: path, Pointer: f.Pointer, ID: f.ID, Err: err}
+	}
+
+	return a.setData(f, append(items, data))
+}
+
+// RemoveItem removes the item at index from the array field at path and rebuilds the fields
+func (a *Alpaca) RemoveItem(path string, index int) error {
+	f, items, err := a.getItems(path)
+	if err != nil {
+		return err
+	}
+
+	if index < 0 || index >= len(items) {
+		return &FieldError{Path: path, Pointer: f.Pointer, ID: f.ID, Err: ErrIndexOutOfRange}
+	}
+
+	// Server values follow the items they were set for
+	return a.setServerData(f, append(items[:index], items[index+1:]...), a.removeServerValues(f, index))
+}
@@ -0,0 +1,169 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+// keyOrder records the declaration order of object keys. It is indexed by the
+// identity of the decoded map so the order follows the object wherever it is
+// referenced from, and holds the map so its address is not reused while recorded.
+type keyOrder map[uintptr]orderedObject
+
+// orderedObject is a decoded object and the order in which its keys were declared
+type orderedObject struct {
+	object map[string]interface{}
+	keys   []string
+}
+
+// set records the key order of an object
+func (o keyOrder) set(object map[string]interface{}, keys []string) {
+	o[reflect.ValueOf(object).Pointer()] = orderedObject{object: object, keys: keys}
+}
+
+// merge records the key orders of another keyOrder
+func (o keyOrder) merge(other keyOrder) {
+	for pointer, ordered := range other {
+		o[pointer] = ordered
+	}
+}
+
+// retain returns the key orders of the objects reachable from the given values,
+// leaving out those of objects that were replaced or merged away since.
+func (o keyOrder) retain(values ...interface{}) keyOrder {
+	retained := keyOrder{}
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			pointer := reflect.ValueOf(v).Pointer()
+			if _, exists := retained[pointer]; exists {
+				return
+			}
+			if ordered, exists := o[pointer]; exists {
+				retained[pointer] = ordered
+			}
+			for _, value := range v {
+				walk(value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				walk(value)
+			}
+		}
+	}
+	for _, value := range values {
+		walk(value)
+	}
+	return retained
+}
+
+// decodeOrdered unmarshals JSON in the same shape as gabs.ParseJSON while
+// remembering the order in which object keys were declared.
+func decodeOrdered(b []byte) (*gabs.Container, keyOrder, error) {
+	order := keyOrder{}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+
+	root, err := order.decode(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, errors.New("invalid character after top-level value")
+	}
+
+	container, _ := gabs.Consume(root)
+	return container, order, nil
+}
+
+func (o keyOrder) decode(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		object := map[string]interface{}{}
+		keys := []string{}
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := token.(string)
+			value, err := o.decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := object[key]; !exists {
+				keys = append(keys, key)
+			}
+			object[key] = value
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		o.set(object, keys)
+		return object, nil
+	case '[':
+		array := []interface{}{}
+		for dec.More() {
+			value, err := o.decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return array, nil
+	}
+
+	return nil, errors.New("unexpected delimiter " + delim.String())
+}
+
+// keys returns the keys of an object in declaration order. Keys that were added
+// after decoding, or objects that were never decoded, fall back to sorted order.
+func (o keyOrder) keys(c *gabs.Container) []string {
+	object, ok := c.Data().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return o.objectKeys(object)
+}
+
+// objectKeys returns the keys of a decoded object in declaration order
+func (o keyOrder) objectKeys(object map[string]interface{}) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, key := range o[reflect.ValueOf(object).Pointer()].keys {
+		if _, exists := object[key]; exists && !seen[key] {
+			result = append(result, key)
+			seen[key] = true
+		}
+	}
+
+	rest := []string{}
+	for key := range object {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(result, rest...)
+}
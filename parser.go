@@ -1,6 +1,9 @@
 package alpaca
 
 import (
+	"bytes"
+	"encoding/json"
+	"sort"
 	"strconv"
 
 	"github.com/Jeffail/gabs"
@@ -10,6 +13,15 @@ import (
 // ParseFieldPath reconstructs JSON based on the field path
 func (a *Alpaca) ParseFieldPath(f *Field, chunk *Chunk, generated *gabs.Container) *gabs.Container {
 
+	if generated == nil {
+		generated = gabs.New()
+	}
+
+	// Values that don't match their schema shape can end the path early
+	if chunk == nil {
+		return generated
+	}
+
 	switch chunk.Type {
 	case "repeatable", "array":
 		if chunk.Connector != nil {
@@ -89,7 +101,7 @@ func (a *Alpaca) ParseFieldPath(f *Field, chunk *Chunk, generated *gabs.Containe
 			itemParsed, _ := gabs.ParseJSON([]byte(item.String()))
 			indexData := generated.Index(intVal).Data()
 			// This shouldn't work, but it does. Something wrong with chunk types
-			if indexData != nil && (chunk.Parent.Type == "object" || chunk.Parent.Type == "repeatable" || chunk.Parent.Type == "array") {
+			if indexData != nil && chunk.Parent != nil && (chunk.Parent.Type == "object" || chunk.Parent.Type == "repeatable" || chunk.Parent.Type == "array") {
 				item2Parsed, _ := gabs.ParseJSON([]byte(generated.Index(intVal).String()))
 				itemParsed.Merge(item2Parsed)
 			}
@@ -118,45 +130,220 @@ func (a *Alpaca) ParseFieldPath(f *Field, chunk *Chunk, generated *gabs.Containe
 
 // Parse takes field registry and parses it into json string
 func (a *Alpaca) Parse() string {
+	output, _ := a.ParseE()
+	return output
+}
+
+// ParseE takes field registry and parses it into json string, returning an error if it cannot be parsed
+func (a *Alpaca) ParseE() (string, error) {
 
 	if a.output == "" {
+		output, err := a.ParseWith(ParseOptions{})
+		if err != nil {
+			return "", err
+		}
+		a.output = output
+	}
 
-		result := gabs.New()
+	return a.output, nil
+}
 
-		if len(a.FieldRegistry) < 2 {
-			if a.FieldRegistry[0].IsContainerField {
-				return `""`
-			}
+// ParseWith takes field registry and parses it into json string using the given options
+func (a *Alpaca) ParseWith(options ParseOptions) (string, error) {
 
-			// return cast.ToString(a.FieldRegistry[0].Value)
+	result := gabs.New()
 
-			switch v := a.FieldRegistry[0].Value.(type) {
-			case int:
-				return cast.ToString(v)
-			case float64:
-				return cast.ToString(v)
-			default:
-				if a.FieldRegistry[0].Type != "select" && a.FieldRegistry[0].Type != "json" && a.FieldRegistry[0].Type != "tag" {
-					return `"` + cast.ToString(v) + `"`
-				}
-				return cast.ToString(v)
+	if len(a.FieldRegistry) == 0 {
+		return "", ErrNoFields
+	}
+
+	if len(a.FieldRegistry) < 2 && len(a.additional) == 0 {
+		if a.FieldRegistry[0].IsContainerField {
+			return `""`, nil
+		}
+
+		if f := a.FieldRegistry[0]; IsEmptyValue(f.Value) && f.GetEmptyPolicy(options.Empty) == EmptyNull {
+			return "null", nil
+		}
 
+		if options.Labels || options.Tuples {
+			output, err := json.Marshal(a.FormatOutput(a.FieldRegistry[0].Value, a.FieldRegistry[0], options))
+			if err != nil {
+				return "", err
 			}
+			return string(output), nil
+		}
+
+		// return cast.ToString(a.FieldRegistry[0].Value)
+
+		switch v := a.FieldRegistry[0].Value.(type) {
+		case int:
+			return cast.ToString(v), nil
+		case float64:
+			return cast.ToString(v), nil
+		default:
+			if a.FieldRegistry[0].Type != "select" && a.FieldRegistry[0].Type != "json" && a.FieldRegistry[0].Type != "tag" {
+				return `"` + cast.ToString(v) + `"`, nil
+			}
+			return cast.ToString(v), nil
+
+		}
+
+	}
+
+	for _, f := range a.FieldRegistry {
+		// fmt.Println(f.PathString)
+		// Checkboxes write their whole answer, so the items of a multi-value one would overwrite it
+		if f.Parent != nil && f.Parent.Type == "checkbox" && f.Parent.GetEnumSchema() != nil {
+			continue
+		}
+		strValue := cast.ToString(f.Value)
+		// Any fields can hold objects and arrays, which have no string form.
+		// Checkboxes are written even when unticked, unless they were left empty.
+		if f.Value != nil && (strValue != "" || f.Type == "any") || f.Type == "checkbox" && f.IsSubmitted() && !f.IsEmptyAnswer() {
+			a.ParseFieldPath(f, &f.Path[0], result)
+		}
+	}
+
+	if len(a.additional) > 0 {
+		result, _ = gabs.Consume(a.MergeAdditionalProperties(result.Data()))
+	}
+
+	result, _ = gabs.Consume(a.MergeEmptyAnswers(result.Data(), options.Empty))
+
+	if options.FormOrder || options.Labels || options.Titles || options.Tuples {
+		output, err := json.Marshal(a.FormatOutput(result.Data(), a.FieldRegistry[0], options))
+		if err != nil {
+			return "", err
+		}
+		return string(output), nil
+	}
+
+	return result.String(), nil
+}
+
+// OrderedObject is a JSON object that marshals its keys in a fixed order
+type OrderedObject struct {
+	Keys   []string
+	Values map[string]interface{}
+}
 
+// MarshalJSON writes the object with its keys in order
+func (o OrderedObject) MarshalJSON() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	buffer.WriteByte('{')
+	for i, key := range o.Keys {
+		if i > 0 {
+			buffer.WriteByte(',')
 		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(o.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(encodedKey)
+		buffer.WriteByte(':')
+		buffer.Write(encodedValue)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
 
-		for _, f := range a.FieldRegistry {
-			// fmt.Println(f.PathString)
-			strValue := cast.ToString(f.Value)
-			if f.Value != nil && strValue != "" || f.Type == "checkbox" {
-				a.ParseFieldPath(f, &f.Path[0], result)
+// FormatOutput rewrites generated output following the field tree. Object keys are put in form or alphabetical
+// order, and answers are swapped for their labels or tuples when requested.
+func (a *Alpaca) FormatOutput(value interface{}, f *Field, options ParseOptions) interface{} {
+	if f != nil && f.IsAnswer() {
+		return f.FormatAnswer(value, options)
+	}
+
+	children := map[string]*Field{}
+	keys := []string{}
+	if f != nil {
+		for _, child := range f.Children {
+			children[child.Key] = child
+			keys = append(keys, child.Key)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if !options.FormOrder {
+			keys = []string{}
+		}
+		object := OrderedObject{Values: map[string]interface{}{}}
+		seen := map[string]bool{}
+		for _, key := range append(keys, a.order.objectKeys(v)...) {
+			if _, exists := v[key]; !exists || seen[key] {
+				continue
 			}
+			seen[key] = true
+
+			name := key
+			if child := children[key]; options.Titles && child != nil && child.Title != "" {
+				name = child.Title
+				if _, taken := object.Values[name]; taken {
+					name = child.Title + " (" + key + ")"
+				}
+			}
+			object.Keys = append(object.Keys, name)
+			object.Values[name] = a.FormatOutput(v[key], children[key], options)
+		}
+		if !options.FormOrder {
+			sort.Strings(object.Keys)
+		}
+		return object
+	case []interface{}:
+		items := []interface{}{}
+		for i, item := range v {
+			items = append(items, a.FormatOutput(item, children[strconv.Itoa(i)], options))
+		}
+		return items
+	}
+
+	return value
+}
+
+// IsAnswer reports whether a field holds a single answer rather than a container of other fields.
+// Multi-value enum fields are answers even when their items are registered as fields.
+func (f *Field) IsAnswer() bool {
+	if len(f.Children) == 0 {
+		return !f.IsContainerField || f.GetEnumSchema() != nil
+	}
+	_, isArray := f.Value.([]interface{})
+	return isArray && f.GetEnumSchema() != nil
+}
+
+// FormatAnswer returns the value of an answer as a label or tuple according to options
+func (f *Field) FormatAnswer(value interface{}, options ParseOptions) interface{} {
+	var label interface{} = value
+	if f.Enum != nil {
+		if _, isArray := value.([]interface{}); isArray {
+			label = f.EnumLabels
+		} else {
+			label = f.EnumLabel
 		}
+	}
+
+	if options.Tuples {
+		return OrderedObject{
+			Keys: []string{"key", "title", "value", "label"},
+			Values: map[string]interface{}{
+				"key":   f.Key,
+				"title": f.Title,
+				"value": value,
+				"label": label,
+			},
+		}
+	}
 
-		a.output = result.String()
+	if options.Labels {
+		return label
 	}
 
-	return a.output
+	return value
 }
 
 // GetPathString returns combined path string - decrepit
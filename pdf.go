@@ -0,0 +1,615 @@
+package alpaca
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// PDFOptions configures RenderPDF. Header and footer text can use the placeholders {page}, {pages} and {ref}.
+type PDFOptions struct {
+	Header  string
+	Footer  string
+	FormRef string
+	// Raw shows submitted values rather than enum labels
+	Raw bool
+	// Page size and margin in points, defaulting to A4 with 50pt margins
+	PageWidth  float64
+	PageHeight float64
+	Margin     float64
+	// MaxImagePixels bounds the width times height of the PNG and GIF images decoded for the report,
+	// defaulting to DefaultPDFMaxImagePixels. Larger images are left out.
+	MaxImagePixels int
+}
+
+// DefaultPDFFooter is used when PDFOptions has no footer
+const DefaultPDFFooter = "Page {page} of {pages}"
+
+// DefaultPDFMaxImagePixels is the largest image decoded for a report when PDFOptions sets no limit, 4096 by 4096
+const DefaultPDFMaxImagePixels = 4096 * 4096
+
+// pdfFonts are the standard PDF fonts used by reports, which readers supply so nothing is embedded
+var pdfFonts = []string{"Helvetica", "Helvetica-Bold"}
+
+// pdfWidths are the widths of printable ASCII characters in thousandths of the font size, per font
+var pdfWidths = [][]int{
+	{278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584},
+	{278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584},
+}
+
+// pdfWinAnsi maps the characters outside Latin-1 that WinAnsiEncoding supports
+var pdfWinAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+const (
+	pdfRegular = iota
+	pdfBold
+)
+
+// pdfImage is an image XObject
+type pdfImage struct {
+	Width      int
+	Height     int
+	ColorSpace string
+	Filter     string
+	Data       []byte
+}
+
+// pdfDocument lays out text and images on pages and writes them as a PDF file
+type pdfDocument struct {
+	options PDFOptions
+	pages   []*bytes.Buffer
+	images  []pdfImage
+	// pageImages lists the images drawn on each page
+	pageImages [][]int
+	y          float64
+}
+
+// RenderPDF writes the fields as a PDF report in form order. Objects become headed sections,
+// repeatable items become numbered blocks, photos follow their fields and signatures are placed at the end.
+func (a *Alpaca) RenderPDF(w io.Writer, options PDFOptions) error {
+	if len(a.FieldRegistry) == 0 {
+		return ErrNoFields
+	}
+
+	if options.PageWidth <= 0 || options.PageHeight <= 0 {
+		options.PageWidth, options.PageHeight = 595.28, 841.89
+	}
+	if options.Margin <= 0 {
+		options.Margin = 50
+	}
+	if options.Footer == "" {
+		options.Footer = DefaultPDFFooter
+	}
+	if options.MaxImagePixels <= 0 {
+		options.MaxImagePixels = DefaultPDFMaxImagePixels
+	}
+
+	doc := &pdfDocument{options: options}
+	doc.newPage()
+
+	signatures := []*Field{}
+	for _, f := range a.FieldRegistry {
+		if f.Parent != nil {
+			continue
+		}
+		if f.IsContainerField && !f.IsAnswer() && !f.IsRepeatable() {
+			if f.Title != "" {
+				doc.heading(f.Title, 18, 0)
+			}
+			for _, child := range f.Children {
+				a.layoutPDFField(doc, child, options, 2, 0, &signatures)
+			}
+			continue
+		}
+		a.layoutPDFField(doc, f, options, 2, 0, &signatures)
+	}
+
+	for _, f := range signatures {
+		doc.signature(f)
+	}
+
+	return doc.write(w)
+}
+
+// layoutPDFField lays out a field and its children, holding signatures back for the end of the report
+func (a *Alpaca) layoutPDFField(doc *pdfDocument, f *Field, options PDFOptions, level int, indent float64, signatures *[]*Field) {
+	if f.SharesParentData() {
+		return
+	}
+
+	switch {
+	case f.Type == "information" || f.Type == "image":
+	case f.Type == "signature":
+		*signatures = append(*signatures, f)
+	case f.IsRepeatable() && f.Schema.Exists("items"):
+		if f.Title != "" {
+			doc.heading(f.Title, pdfHeadingSize(level), indent)
+		}
+		for i, item := range f.Children {
+			if item.SharesParentData() {
+				continue
+			}
+			if item.IsContainerField && !item.IsAnswer() {
+				doc.heading(f.GetItemTitle(i), pdfHeadingSize(level+1), indent+12)
+				for _, child := range item.Children {
+					a.layoutPDFField(doc, child, options, level+2, indent+12, signatures)
+				}
+				continue
+			}
+			a.layoutPDFField(doc, item, options, level+1, indent+12, signatures)
+		}
+	case f.IsContainerField && !f.IsAnswer() && f.Type == "object":
+		if f.Title != "" {
+			doc.heading(f.Title, pdfHeadingSize(level), indent)
+		}
+		for _, child := range f.Children {
+			a.layoutPDFField(doc, child, options, level+1, indent, signatures)
+		}
+	default:
+		title := f.Title
+		if title == "" {
+			title = f.Key
+		}
+		doc.row(title, f.DisplayValue(options.Raw), indent)
+		doc.photos(f.Media, indent)
+	}
+}
+
+// GetItemTitle returns the heading of a repeatable item, numbered from 1
+func (f *Field) GetItemTitle(index int) string {
+	title := f.Title
+	if f.Schema.Exists("items", "title") {
+		title = cast.ToString(f.Schema.S("items", "title").Data())
+	}
+	if title == "" {
+		title = "Item"
+	}
+	return title + " " + strconv.Itoa(index+1)
+}
+
+// pdfHeadingSize returns the font size of a heading at a level of the field tree
+func pdfHeadingSize(level int) float64 {
+	size := 16 - 2*float64(level-2)
+	if size < 11 {
+		size = 11
+	}
+	return size
+}
+
+// pdfEncode converts text to WinAnsiEncoding, replacing characters it cannot represent
+func pdfEncode(text string) []byte {
+	encoded := []byte{}
+	for _, r := range text {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			encoded = append(encoded, ' ')
+		case r >= 0x20 && r <= 0x7e, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		case pdfWinAnsi[r] != 0:
+			encoded = append(encoded, pdfWinAnsi[r])
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// pdfTextWidth returns the width of text in points
+func pdfTextWidth(text string, font int, size float64) float64 {
+	width := 0
+	for _, c := range pdfEncode(text) {
+		if c >= 0x20 && c <= 0x7e {
+			width += pdfWidths[font][c-0x20]
+		} else {
+			width += 556
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// pdfWrap breaks text into lines no wider than width, breaking long words where they overflow
+func pdfWrap(text string, font int, size float64, width float64) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if pdfTextWidth(candidate, font, size) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			line = ""
+			for _, r := range word {
+				if line != "" && pdfTextWidth(line+string(r), font, size) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfString returns text as an escaped PDF string literal
+func pdfString(text string) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteByte('(')
+	for _, c := range pdfEncode(text) {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			buffer.WriteByte('\\')
+			buffer.WriteByte(c)
+		case c > 0x7e:
+			fmt.Fprintf(buffer, "\\%03o", c)
+		default:
+			buffer.WriteByte(c)
+		}
+	}
+	buffer.WriteByte(')')
+	return buffer.String()
+}
+
+// pdfNumber formats a coordinate
+func pdfNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', 2, 64)
+}
+
+// top returns the y position content starts at on each page
+func (d *pdfDocument) top() float64 {
+	return d.options.PageHeight - d.options.Margin
+}
+
+// newPage starts a new page
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+	d.pageImages = append(d.pageImages, nil)
+	d.y = d.top()
+}
+
+// ensure starts a new page unless height fits above the bottom margin
+func (d *pdfDocument) ensure(height float64) {
+	if d.y-height < d.options.Margin && d.y < d.top() {
+		d.newPage()
+	}
+}
+
+// text draws a line of text on the current page with its baseline at y
+func (d *pdfDocument) text(x float64, y float64, text string, font int, size float64) {
+	pdfText(d.pages[len(d.pages)-1], x, y, text, font, size)
+}
+
+// pdfText draws a line of text on a page with its baseline at y
+func pdfText(page *bytes.Buffer, x float64, y float64, text string, font int, size float64) {
+	fmt.Fprintf(page, "BT /F%d %s Tf %s %s Td %s Tj ET\n", font+1, pdfNumber(size), pdfNumber(x), pdfNumber(y), pdfString(text))
+}
+
+// heading draws a section heading
+func (d *pdfDocument) heading(title string, size float64, indent float64) {
+	width := d.options.PageWidth - 2*d.options.Margin - indent
+	lines := pdfWrap(title, pdfBold, size, width)
+	d.ensure(float64(len(lines))*size*1.3 + size)
+	d.y -= size * 0.6
+	for _, line := range lines {
+		d.y -= size * 1.2
+		d.text(d.options.Margin+indent, d.y, line, pdfBold, size)
+	}
+	d.y -= size * 0.4
+}
+
+// row draws a question and its answer side by side with a rule underneath
+func (d *pdfDocument) row(question string, answer string, indent float64) {
+	const size, leading = 10, 13
+	width := d.options.PageWidth - 2*d.options.Margin - indent
+	questionWidth := width * 0.4
+	questions := pdfWrap(question, pdfBold, size, questionWidth-8)
+	answers := pdfWrap(answer, pdfRegular, size, width-questionWidth)
+
+	for len(questions) > 0 || len(answers) > 0 {
+		lines := len(questions)
+		if len(answers) > lines {
+			lines = len(answers)
+		}
+
+		// Rows taller than the rest of the page carry on over the next one
+		fit := int((d.y - d.options.Margin - 6) / leading)
+		if fit < lines {
+			if fit < 1 && d.y < d.top() {
+				d.newPage()
+				continue
+			}
+			// Pages too small for a single line still take one, so the row ends
+			if fit < 1 {
+				fit = 1
+			}
+			lines = fit
+		}
+
+		x := d.options.Margin + indent
+		for i := 0; i < lines; i++ {
+			d.y -= leading
+			if i < len(questions) {
+				d.text(x, d.y, questions[i], pdfBold, size)
+			}
+			if i < len(answers) {
+				d.text(x+questionWidth, d.y, answers[i], pdfRegular, size)
+			}
+		}
+		if lines > len(questions) {
+			questions = nil
+		} else {
+			questions = questions[lines:]
+		}
+		if lines > len(answers) {
+			answers = nil
+		} else {
+			answers = answers[lines:]
+		}
+	}
+
+	d.y -= 4
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0.85 G 0.5 w %s %s m %s %s l S 0 G\n", pdfNumber(d.options.Margin+indent), pdfNumber(d.y), pdfNumber(d.options.PageWidth-d.options.Margin), pdfNumber(d.y))
+	d.y -= 2
+}
+
+// photos draws images in rows beneath a field, scaled to thumbnails
+func (d *pdfDocument) photos(media []ImageFile, indent float64) {
+	const maxWidth, maxHeight, gap = 180, 135, 8
+	x := d.options.Margin + indent
+	rowHeight := 0.0
+	for _, file := range media {
+		contents, err := hex.DecodeString(file.Data)
+		if err != nil {
+			continue
+		}
+		index, err := d.addImage(contents)
+		if err != nil {
+			continue
+		}
+		width, height := d.images[index].fit(maxWidth, maxHeight)
+
+		if x+width > d.options.PageWidth-d.options.Margin && x > d.options.Margin+indent {
+			d.y -= rowHeight + gap
+			x = d.options.Margin + indent
+			rowHeight = 0
+		}
+		if d.y-height-gap < d.options.Margin {
+			d.y -= rowHeight
+			d.newPage()
+			x = d.options.Margin + indent
+			rowHeight = 0
+		}
+		d.image(index, x, d.y-gap-height, width, height)
+		x += width + gap
+		if height > rowHeight {
+			rowHeight = height
+		}
+	}
+	if rowHeight > 0 {
+		d.y -= rowHeight + 2*gap
+	}
+}
+
+// signature draws a signature field with its image, taken from its media or a data URI answer
+func (d *pdfDocument) signature(f *Field) {
+	const maxWidth, maxHeight = 220, 90
+	contents := []byte{}
+	if len(f.Media) > 0 {
+		contents, _ = hex.DecodeString(f.Media[0].Data)
+	} else if value := f.String(); strings.HasPrefix(value, "data:image/") {
+		if comma := strings.Index(value, ","); comma >= 0 {
+			contents, _ = base64.StdEncoding.DecodeString(value[comma+1:])
+		}
+	}
+
+	title := f.Title
+	if title == "" {
+		title = "Signature"
+	}
+
+	index, err := d.addImage(contents)
+	if err != nil {
+		d.row(title, f.DisplayValue(false), 0)
+		return
+	}
+
+	width, height := d.images[index].fit(maxWidth, maxHeight)
+	d.ensure(height + 40)
+	d.heading(title, 12, 0)
+	d.image(index, d.options.Margin, d.y-height, width, height)
+	d.y -= height + 4
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0 G 0.75 w %s %s m %s %s l S\n", pdfNumber(d.options.Margin), pdfNumber(d.y), pdfNumber(d.options.Margin+maxWidth), pdfNumber(d.y))
+	d.y -= 12
+}
+
+// image draws an image on the current page
+func (d *pdfDocument) image(index int, x float64, y float64, width float64, height float64) {
+	page := len(d.pages) - 1
+	d.pageImages[page] = append(d.pageImages[page], index)
+	fmt.Fprintf(d.pages[page], "q %s 0 0 %s %s %s cm /Im%d Do Q\n", pdfNumber(width), pdfNumber(height), pdfNumber(x), pdfNumber(y), index+1)
+}
+
+// addImage decodes an image and adds it to the document. JPEGs are embedded as they are, other formats as RGB on white.
+func (d *pdfDocument) addImage(contents []byte) (int, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(contents))
+	if err != nil {
+		return 0, err
+	}
+	// Decoding allocates for every pixel, so the size is checked before anything is decoded
+	if format != "jpeg" && (config.Width > d.options.MaxImagePixels || config.Height > d.options.MaxImagePixels || config.Width*config.Height > d.options.MaxImagePixels) {
+		return 0, ErrImageTooLarge
+	}
+
+	img := pdfImage{Width: config.Width, Height: config.Height}
+	if format == "jpeg" {
+		img.Filter = "DCTDecode"
+		img.Data = contents
+		switch config.ColorModel {
+		case color.GrayModel:
+			img.ColorSpace = "DeviceGray"
+		case color.CMYKModel:
+			img.ColorSpace = "DeviceCMYK"
+		default:
+			img.ColorSpace = "DeviceRGB"
+		}
+	} else {
+		decoded, _, err := image.Decode(bytes.NewReader(contents))
+		if err != nil {
+			return 0, err
+		}
+		bounds := decoded.Bounds()
+		pixels := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				// Colours are premultiplied, so adding the missing alpha composites them over white
+				r, g, b, alpha := decoded.At(x, y).RGBA()
+				pixels = append(pixels, byte((r+0xffff-alpha)>>8), byte((g+0xffff-alpha)>>8), byte((b+0xffff-alpha)>>8))
+			}
+		}
+		compressed := new(bytes.Buffer)
+		writer := zlib.NewWriter(compressed)
+		writer.Write(pixels)
+		writer.Close()
+
+		img.Width, img.Height = bounds.Dx(), bounds.Dy()
+		img.ColorSpace = "DeviceRGB"
+		img.Filter = "FlateDecode"
+		img.Data = compressed.Bytes()
+	}
+
+	d.images = append(d.images, img)
+	return len(d.images) - 1, nil
+}
+
+// fit returns the size of an image scaled down to fit within a box, keeping its aspect ratio
+func (i pdfImage) fit(maxWidth float64, maxHeight float64) (float64, float64) {
+	width, height := float64(i.Width), float64(i.Height)
+	if width <= 0 || height <= 0 {
+		return maxWidth, maxHeight
+	}
+	scale := 1.0
+	if width*scale > maxWidth {
+		scale = maxWidth / width
+	}
+	if height*scale > maxHeight {
+		scale = maxHeight / height
+	}
+	return width * scale, height * scale
+}
+
+// pageText fills the header and footer placeholders for a page
+func (d *pdfDocument) pageText(text string, page int) string {
+	text = strings.Replace(text, "{page}", strconv.Itoa(page), -1)
+	text = strings.Replace(text, "{pages}", strconv.Itoa(len(d.pages)), -1)
+	return strings.Replace(text, "{ref}", d.options.FormRef, -1)
+}
+
+// write adds headers and footers to the pages and writes the document
+func (d *pdfDocument) write(w io.Writer) error {
+	const size = 8
+	for i, page := range d.pages {
+		header := d.pageText(d.options.Header, i+1)
+		if header != "" {
+			pdfText(page, d.options.Margin, d.options.PageHeight-d.options.Margin/2, header, pdfRegular, size)
+		}
+		if d.options.FormRef != "" && !strings.Contains(d.options.Header, "{ref}") {
+			ref := d.options.FormRef
+			pdfText(page, d.options.PageWidth-d.options.Margin-pdfTextWidth(ref, pdfRegular, size), d.options.PageHeight-d.options.Margin/2, ref, pdfRegular, size)
+		}
+		footer := d.pageText(d.options.Footer, i+1)
+		pdfText(page, (d.options.PageWidth-pdfTextWidth(footer, pdfRegular, size))/2, d.options.Margin/2, footer, pdfRegular, size)
+	}
+
+	buffer := new(bytes.Buffer)
+	offsets := []int{}
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, buffer.Len())
+		fmt.Fprintf(buffer, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buffer.WriteString("stream\n")
+			buffer.Write(stream)
+			buffer.WriteString("\nendstream\n")
+		}
+		buffer.WriteString("endobj\n")
+	}
+
+	// Objects are numbered catalog, pages, fonts, images, then a page and its content for each page
+	fontObject := 3
+	imageObject := fontObject + len(pdfFonts)
+	pageObject := imageObject + len(d.images)
+
+	buffer.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+
+	kids := []string{}
+	for i := range d.pages {
+		kids = append(kids, strconv.Itoa(pageObject+2*i)+" 0 R")
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)), nil)
+
+	for _, font := range pdfFonts {
+		object("<< /Type /Font /Subtype /Type1 /BaseFont /"+font+" /Encoding /WinAnsiEncoding >>", nil)
+	}
+
+	for _, img := range d.images {
+		object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s /Length %d >>",
+			img.Width, img.Height, img.ColorSpace, img.Filter, len(img.Data)), img.Data)
+	}
+
+	fonts := []string{}
+	for i := range pdfFonts {
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, fontObject+i))
+	}
+	for i, page := range d.pages {
+		images := []string{}
+		seen := map[int]bool{}
+		for _, index := range d.pageImages[i] {
+			if !seen[index] {
+				seen[index] = true
+				images = append(images, fmt.Sprintf("/Im%d %d 0 R", index+1, imageObject+index))
+			}
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s >> /XObject << %s >> >> /Contents %d 0 R >>",
+			pdfNumber(d.options.PageWidth), pdfNumber(d.options.PageHeight), strings.Join(fonts, " "), strings.Join(images, " "), pageObject+2*i+1), nil)
+		object(fmt.Sprintf("<< /Length %d >>", page.Len()), page.Bytes())
+	}
+
+	xref := buffer.Len()
+	fmt.Fprintf(buffer, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := buffer.WriteTo(w)
+	return err
+}
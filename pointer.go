@@ -0,0 +1,228 @@
+package alpaca
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GetPointer returns the RFC 6901 JSON Pointer of the field's value within the data, e.g. /list/2/device
+func (f *Field) GetPointer() string {
+	pointer := ""
+	for _, segment := range f.dataSegments() {
+		if segment.IsIndex {
+			pointer += "/" + strconv.Itoa(segment.Index)
+		} else {
+			pointer += "/" + EscapePointerToken(segment.Key)
+		}
+	}
+	return pointer
+}
+
+// GetJSONPath returns the normalised JSONPath of the field's value within the data, e.g. $['list'][2]['device']
+func (f *Field) GetJSONPath() string {
+	path := "$"
+	for _, segment := range f.dataSegments() {
+		if segment.IsIndex {
+			path += "[" + strconv.Itoa(segment.Index) + "]"
+		} else {
+			path += "['" + escapeJSONPathName(segment.Key) + "']"
+		}
+	}
+	return path
+}
+
+// GetChildPointer returns the pointer of a field created under connector with the given key
+func GetChildPointer(connector *Field, key string) string {
+	if connector == nil {
+		return ""
+	}
+	return connector.Pointer + "/" + EscapePointerToken(key)
+}
+
+// EscapePointerToken escapes a reference token for use in a JSON Pointer
+func EscapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// ParsePointer splits a JSON Pointer into its unescaped reference tokens
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if pointer[0] != '/' {
+		return nil, ErrPathInvalid
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, ErrPathInvalid
+			}
+		}
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// escapeJSONPathName escapes a member name for a single quoted normalised JSONPath selector
+func escapeJSONPathName(name string) string {
+	result := ""
+	for _, r := range name {
+		switch r {
+		case '\'':
+			result += `\'`
+		case '\\':
+			result += `\\`
+		case '\b':
+			result += `\b`
+		case '\f':
+			result += `\f`
+		case '\n':
+			result += `\n`
+		case '\r':
+			result += `\r`
+		case '\t':
+			result += `\t`
+		default:
+			if r < 0x20 {
+				result += fmt.Sprintf(`\u%04x`, r)
+			} else {
+				result += string(r)
+			}
+		}
+	}
+	return result
+}
+
+// ParseJSONPath splits a singular JSONPath such as $.list[2].device or $['list'][2]['device'] into its member names and indices
+func ParseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, ErrPathInvalid
+	}
+
+	tokens := []string{}
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			j := i + 1
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			if j == i+1 {
+				return nil, ErrPathInvalid
+			}
+			tokens = append(tokens, path[i+1:j])
+			i = j
+		case '[':
+			if i+1 >= len(path) {
+				return nil, ErrPathInvalid
+			}
+			if quote := path[i+1]; quote == '\'' || quote == '"' {
+				name, end, err := parseJSONPathName(path, i+2, quote)
+				if err != nil {
+					return nil, err
+				}
+				if end >= len(path) || path[end] != ']' {
+					return nil, ErrPathInvalid
+				}
+				tokens = append(tokens, name)
+				i = end + 1
+			} else {
+				end := strings.IndexByte(path[i:], ']')
+				if end < 0 {
+					return nil, ErrPathInvalid
+				}
+				index, err := strconv.Atoi(path[i+1 : i+end])
+				if err != nil || index < 0 {
+					return nil, ErrPathInvalid
+				}
+				tokens = append(tokens, strconv.Itoa(index))
+				i += end + 1
+			}
+		default:
+			return nil, ErrPathInvalid
+		}
+	}
+	return tokens, nil
+}
+
+// parseJSONPathName reads a quoted member name starting at i, returning it and the index after the closing quote
+func parseJSONPathName(path string, i int, quote byte) (string, int, error) {
+	name := ""
+	for i < len(path) {
+		switch c := path[i]; {
+		case c == quote:
+			return name, i + 1, nil
+		case c == '\\':
+			if i+1 >= len(path) {
+				return "", 0, ErrPathInvalid
+			}
+			switch escaped := path[i+1]; escaped {
+			case 'b':
+				name += "\b"
+			case 'f':
+				name += "\f"
+			case 'n':
+				name += "\n"
+			case 'r':
+				name += "\r"
+			case 't':
+				name += "\t"
+			case 'u':
+				if i+6 > len(path) {
+					return "", 0, ErrPathInvalid
+				}
+				code, err := strconv.ParseUint(path[i+2:i+6], 16, 32)
+				if err != nil {
+					return "", 0, ErrPathInvalid
+				}
+				name += string(rune(code))
+				i += 4
+			default:
+				name += string(escaped)
+			}
+			i += 2
+		default:
+			name += string(c)
+			i++
+		}
+	}
+	return "", 0, ErrPathInvalid
+}
+
+// FieldByPointer returns the field whose value is at an RFC 6901 JSON Pointer
+func (a *Alpaca) FieldByPointer(pointer string) (*Field, error) {
+	tokens, err := ParsePointer(pointer)
+	if err != nil {
+		return nil, &FieldError{Path: pointer, Err: err}
+	}
+	return a.fieldByTokens(pointer, tokens)
+}
+
+// FieldByJSONPath returns the field whose value is at a singular JSONPath
+func (a *Alpaca) FieldByJSONPath(path string) (*Field, error) {
+	tokens, err := ParseJSONPath(path)
+	if err != nil {
+		return nil, &FieldError{Path: path, Err: err}
+	}
+	return a.fieldByTokens(path, tokens)
+}
+
+func (a *Alpaca) fieldByTokens(path string, tokens []string) (*Field, error) {
+	if a.pointerIndex == nil {
+		a.indexFields()
+	}
+
+	pointer := ""
+	for _, token := range tokens {
+		pointer += "/" + EscapePointerToken(token)
+	}
+
+	f := a.pointerIndex[pointer]
+	if f == nil {
+		return nil, &FieldError{Path: path, Pointer: pointer, Err: ErrFieldNotFound}
+	}
+	return f, nil
+}
@@ -0,0 +1,120 @@
+package alpaca
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// TamperEvent records a submitted value for a readonly or hidden field being replaced by the enforced value
+type TamperEvent struct {
+	Path      string
+	Pointer   string
+	ID        string
+	Type      string
+	Submitted interface{}
+	Enforced  interface{}
+}
+
+// IsProtected reports whether a field is readonly or hidden and so only accepts schema or server values
+func (f *Field) IsProtected() bool {
+	return f.ReadOnly || f.Hidden
+}
+
+// GetEnforcedValue returns the value a protected field must hold.
+// Server values take precedence, readonly fields fall back to their schema default and hidden fields to nothing.
+func (a *Alpaca) GetEnforcedValue(f *Field) interface{} {
+	if value, ok := a.serverValues[f.Pointer]; ok {
+		return value
+	}
+	if f.ReadOnly {
+		return f.Default
+	}
+	return nil
+}
+
+// removeServerValues returns the server values without those of item index of an array,
+// the values of the items after it moving up with them
+func (a *Alpaca) removeServerValues(array *Field, index int) map[string]interface{} {
+	values := map[string]interface{}{}
+	prefix := array.Pointer + "/"
+	for pointer, value := range a.serverValues {
+		if !strings.HasPrefix(pointer, prefix) {
+			values[pointer] = value
+			continue
+		}
+
+		token, rest := pointer[len(prefix):], ""
+		if i := strings.Index(token, "/"); i >= 0 {
+			token, rest = token[:i], token[i:]
+		}
+		item, err := strconv.Atoi(token)
+		switch {
+		case err != nil || item < index:
+			values[pointer] = value
+		case item > index:
+			values[prefix+strconv.Itoa(item-1)+rest] = value
+		}
+	}
+	return values
+}
+
+// Protect replaces the submitted value of a readonly or hidden field with its enforced value
+func (a *Alpaca) Protect(f *Field) {
+	if !f.IsProtected() {
+		return
+	}
+
+	// Items without a schema share their data with the parent, which has already been protected
+	if f.SharesParentData() {
+		return
+	}
+
+	enforced := a.GetEnforcedValue(f)
+	if data, err := toData(enforced); err == nil {
+		enforced = data
+	}
+
+	var submitted interface{}
+	if f.IsSubmitted() {
+		submitted = f.Data.Data()
+	}
+	if reflect.DeepEqual(submitted, enforced) {
+		return
+	}
+
+	if submitted != nil {
+		tamperType := "hidden"
+		if f.ReadOnly {
+			tamperType = "readonly"
+		}
+		a.TamperEvents = append(a.TamperEvents, TamperEvent{Path: f.PathString, Pointer: f.Pointer, ID: f.ID, Type: tamperType, Submitted: submitted, Enforced: enforced})
+	}
+
+	if enforced == nil {
+		a.RemoveFieldData(f)
+		return
+	}
+	a.SetFieldData(f, enforced)
+}
+
+// RemoveFieldData clears the data of a field, removing its key from the parent object
+func (a *Alpaca) RemoveFieldData(f *Field) {
+	a.SetFieldData(f, nil)
+	if f.Parent == nil {
+		return
+	}
+	if parent, ok := f.Parent.Data.Data().(map[string]interface{}); ok {
+		delete(parent, f.Key)
+	}
+}
+
+// GetProtection reads the readonly and hidden settings of a field from its schema and options
+func (f *Field) GetProtection() {
+	if f.Options.Exists("readonly") {
+		f.ReadOnly = f.ReadOnly || cast.ToBool(f.Options.S("readonly").Data())
+	}
+	f.Hidden = f.Type == "hidden" || cast.ToBool(f.Options.S("hidden").Data())
+}
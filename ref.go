@@ -0,0 +1,226 @@
+package alpaca
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+// DefaultMaxRefDepth bounds how many $refs may be active at once, counting those of enclosing fields
+const DefaultMaxRefDepth = 32
+
+// RefLoader returns the document a $ref such as common.json#/definitions/yes_no points into, given common.json
+type RefLoader func(uri string) ([]byte, error)
+
+// FSRefLoader loads the documents $refs point into from a file system such as an embed.FS
+func FSRefLoader(fsys fs.FS) RefLoader {
+	return func(uri string) ([]byte, error) {
+		return fs.ReadFile(fsys, path.Clean(strings.TrimPrefix(uri, "/")))
+	}
+}
+
+// RefError reports a $ref that cannot be resolved
+type RefError struct {
+	Ref string
+	Err error
+}
+
+func (e *RefError) Error() string {
+	return e.Ref + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error so it can be matched with errors.Is
+func (e *RefError) Unwrap() error {
+	return e.Err
+}
+
+// activeRef is a $ref followed to resolve a field or one of the fields enclosing it.
+// Schema and options refs are kept apart as local refs point into different documents.
+type activeRef struct {
+	Options  bool
+	URI      string
+	Fragment string
+}
+
+// resolveRefs follows the $refs of a field's schema and options. The refs followed stay active for the fields
+// created beneath it, so a schema that refers back to itself is caught, until releaseRefs is called with their count.
+func (a *Alpaca) resolveRefs(schema *gabs.Container, options *gabs.Container) (*gabs.Container, *gabs.Container, int, error) {
+	schema, schemaRefs, err := a.resolveRef(schema, a.schema, false)
+	if err != nil {
+		a.releaseRefs(schemaRefs)
+		return schema, options, 0, err
+	}
+	options, optionsRefs, err := a.resolveRef(options, a.options, true)
+	if err != nil {
+		a.releaseRefs(schemaRefs + optionsRefs)
+		return schema, options, 0, err
+	}
+	return schema, options, schemaRefs + optionsRefs, nil
+}
+
+// releaseRefs deactivates the last count refs once the field they resolved has been created
+func (a *Alpaca) releaseRefs(count int) {
+	a.refs = a.refs[:len(a.refs)-count]
+}
+
+// resolveRef follows the $ref of a container until it reaches one without, returning the number of refs followed.
+// Keys set beside a $ref override those of the container it points to, so a shared definition can be retitled.
+func (a *Alpaca) resolveRef(c *gabs.Container, root *gabs.Container, options bool) (*gabs.Container, int, error) {
+	// Local refs point into the document of the closest enclosing ref, or the form itself
+	uri := ""
+	for i := len(a.refs) - 1; i >= 0; i-- {
+		if a.refs[i].Options == options {
+			uri = a.refs[i].URI
+			break
+		}
+	}
+
+	followed := 0
+	for c != nil {
+		ref, ok := c.S("$ref").Data().(string)
+		if !ok {
+			return c, followed, nil
+		}
+
+		active := activeRef{Options: options, URI: uri}
+		if i := strings.Index(ref, "#"); i >= 0 {
+			if ref[:i] != "" {
+				active.URI = resolveURI(uri, ref[:i])
+			}
+			active.Fragment = ref[i+1:]
+		} else {
+			active.URI = resolveURI(uri, ref)
+		}
+
+		for _, existing := range a.refs {
+			if existing == active {
+				return c, followed, &RefError{Ref: ref, Err: ErrRefRecursive}
+			}
+		}
+		if len(a.refs) >= a.maxRefDepth {
+			return c, followed, &RefError{Ref: ref, Err: ErrRefDepth}
+		}
+		a.refs = append(a.refs, active)
+		followed++
+
+		document := root
+		if active.URI != "" {
+			var err error
+			if document, err = a.loadRef(active.URI); err != nil {
+				return c, followed, &RefError{Ref: ref, Err: err}
+			}
+		}
+		target, err := lookupPointer(document, active.Fragment)
+		if err != nil {
+			return c, followed, &RefError{Ref: ref, Err: err}
+		}
+
+		c = a.mergeRef(target, c)
+		uri = active.URI
+	}
+	return c, followed, nil
+}
+
+// resolveURI returns the document a $ref points into, relative $refs being resolved against the document they are in
+func resolveURI(base string, ref string) string {
+	if base == "" || strings.HasPrefix(ref, "/") || strings.Contains(ref, "://") {
+		return ref
+	}
+	return path.Join(path.Dir(base), ref)
+}
+
+// loadRef returns a document loaded for $refs, loading it on first use
+func (a *Alpaca) loadRef(uri string) (*gabs.Container, error) {
+	if document, exists := a.refDocuments[uri]; exists {
+		return document, nil
+	}
+	if a.refLoader == nil {
+		return nil, ErrRefLoaderMissing
+	}
+
+	b, err := a.refLoader(uri)
+	if err != nil {
+		return nil, err
+	}
+	document, order, err := decodeOrdered(b)
+	if err != nil {
+		return nil, ErrRefInvalid
+	}
+	a.order.merge(order)
+
+	if a.refDocuments == nil {
+		a.refDocuments = map[string]*gabs.Container{}
+	}
+	a.refDocuments[uri] = document
+	return document, nil
+}
+
+// mergeRef returns the container a $ref points to with the keys set beside the $ref laid over it
+func (a *Alpaca) mergeRef(target *gabs.Container, ref *gabs.Container) *gabs.Container {
+	overrides := ref.Data().(map[string]interface{})
+	object, ok := target.Data().(map[string]interface{})
+	if !ok || len(overrides) == 1 {
+		return target
+	}
+
+	// The definition is shared, so the merge goes into a copy
+	merged := map[string]interface{}{}
+	keys := a.order.objectKeys(object)
+	for _, key := range keys {
+		merged[key] = object[key]
+	}
+	for _, key := range a.order.objectKeys(overrides) {
+		if key == "$ref" {
+			continue
+		}
+		if _, exists := merged[key]; !exists {
+			keys = append(keys, key)
+		}
+		merged[key] = overrides[key]
+	}
+	a.order.set(merged, keys)
+
+	container, _ := gabs.Consume(merged)
+	return container
+}
+
+// lookupPointer returns the container a JSON Pointer fragment such as /definitions/yes_no points to
+func lookupPointer(document *gabs.Container, fragment string) (*gabs.Container, error) {
+	if fragment == "" {
+		return document, nil
+	}
+	if !strings.HasPrefix(fragment, "/") {
+		return nil, ErrRefInvalid
+	}
+
+	c := document
+	for _, token := range strings.Split(fragment[1:], "/") {
+		// Fragments are URI encoded, so a key such as "yes no" is written yes%20no
+		token, err := url.PathUnescape(token)
+		if err != nil {
+			return nil, ErrRefInvalid
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch v := c.Data().(type) {
+		case map[string]interface{}:
+			value, exists := v[token]
+			if !exists {
+				return nil, ErrRefInvalid
+			}
+			c, _ = gabs.Consume(value)
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, ErrRefInvalid
+			}
+			c, _ = gabs.Consume(v[index])
+		default:
+			return nil, ErrRefInvalid
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,283 @@
+package alpaca
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// RenderOptions configures Render
+type RenderOptions struct {
+	// Templates override the default templates. They are looked up by field type first, e.g. "signature",
+	// then by kind: "form", "section", "table", "list" or "field".
+	Templates map[string]*template.Template
+	// Raw shows submitted values rather than enum labels
+	Raw bool
+}
+
+// RenderField is the data passed to render templates
+type RenderField struct {
+	Field *Field
+	ID    string
+	Title string
+	Type  string
+	// Level is the heading level of a section, from 2 for top level sections up to 6
+	Level int
+	// Value is the answer as shown to people
+	Value string
+	// Image is set when the answer itself is an image, as signatures are
+	Image    template.URL
+	Media    []RenderMedia
+	Children []template.HTML
+	// Columns and Rows are set for tables, one row per repeatable item
+	Columns []string
+	Rows    [][]template.HTML
+	// InTable is set for fields rendered in a table cell, where the column holds the title
+	InTable bool
+}
+
+// RenderMedia is an image attached to a field
+type RenderMedia struct {
+	Name   string
+	Src    template.URL
+	Width  int
+	Height int
+}
+
+// renderFuncs are available to all render templates
+var renderFuncs = template.FuncMap{
+	"heading": func(level int, title string) template.HTML {
+		tag := "h" + strconv.Itoa(level)
+		return template.HTML("<" + tag + ">" + html.EscapeString(title) + "</" + tag + ">")
+	},
+}
+
+// DefaultRenderTemplates are used for any kind not overridden by RenderOptions
+var DefaultRenderTemplates = map[string]*template.Template{
+	"form": template.Must(template.New("form").Funcs(renderFuncs).Parse(
+		`<article class="alpaca-form">{{if .Title}}<h1>{{.Title}}</h1>{{end}}{{range .Children}}{{.}}{{end}}</article>`)),
+	"section": template.Must(template.New("section").Funcs(renderFuncs).Parse(
+		`<section class="alpaca-section" id="{{.ID}}">{{if .Title}}{{heading .Level .Title}}{{end}}{{range .Children}}{{.}}{{end}}</section>`)),
+	"table": template.Must(template.New("table").Funcs(renderFuncs).Parse(
+		`<section class="alpaca-section" id="{{.ID}}">{{if .Title}}{{heading .Level .Title}}{{end}}<table class="alpaca-table">` +
+			`<thead><tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr></thead>` +
+			`<tbody>{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>{{end}}</tbody></table></section>`)),
+	"list": template.Must(template.New("list").Funcs(renderFuncs).Parse(
+		`<section class="alpaca-section" id="{{.ID}}">{{if .Title}}{{heading .Level .Title}}{{end}}<ul class="alpaca-list">{{range .Children}}<li>{{.}}</li>{{end}}</ul></section>`)),
+	"field": template.Must(template.New("field").Funcs(renderFuncs).Parse(
+		`<div class="alpaca-field alpaca-{{.Type}}" id="{{.ID}}">` +
+			`{{if and .Title (not .InTable)}}<span class="alpaca-title">{{.Title}}</span> {{end}}` +
+			`{{if .Image}}<img class="alpaca-image" src="{{.Image}}" alt="{{.Title}}">{{else}}<span class="alpaca-value">{{.Value}}</span>{{end}}` +
+			`{{range .Media}}<img class="alpaca-thumbnail" src="{{.Src}}" alt="{{.Name}}" width="{{.Width}}" height="{{.Height}}">{{end}}</div>`)),
+}
+
+// Render writes the fields as a human readable HTML report in form order.
+// Objects become sections, repeatables of objects become tables and information fields are skipped.
+func (a *Alpaca) Render(w io.Writer, options RenderOptions) error {
+	if len(a.FieldRegistry) == 0 {
+		return ErrNoFields
+	}
+
+	form := RenderField{}
+	for _, f := range a.FieldRegistry {
+		if f.Parent != nil {
+			continue
+		}
+		if f.IsContainerField && !f.IsAnswer() && !f.IsRepeatable() {
+			// The form itself has no section, its fields are the top level
+			form.ID = f.ID
+			form.Title = f.Title
+			children, err := a.renderChildren(f, options, 2)
+			if err != nil {
+				return err
+			}
+			form.Children = append(form.Children, children...)
+			continue
+		}
+		rendered, err := a.renderField(f, options, 2, false)
+		if err != nil {
+			return err
+		}
+		form.Children = append(form.Children, rendered)
+	}
+
+	return options.lookup("", "form").Execute(w, form)
+}
+
+// lookup returns the template for a field type, falling back to the template for its kind
+func (o RenderOptions) lookup(fieldType string, kind string) *template.Template {
+	if t, ok := o.Templates[fieldType]; ok && fieldType != "" {
+		return t
+	}
+	if t, ok := o.Templates[kind]; ok {
+		return t
+	}
+	return DefaultRenderTemplates[kind]
+}
+
+// IsRepeatable reports whether a field is an array of items rather than a single multi-value answer
+func (f *Field) IsRepeatable() bool {
+	switch f.Type {
+	case "array", "repeatable":
+		return !f.IsAnswer()
+	}
+	return false
+}
+
+// renderChildren renders the children of a field that are shown in reports
+func (a *Alpaca) renderChildren(f *Field, options RenderOptions, level int) ([]template.HTML, error) {
+	children := []template.HTML{}
+	for _, child := range f.Children {
+		if child.SharesParentData() {
+			continue
+		}
+		switch child.Type {
+		case "information", "image":
+			continue
+		}
+		rendered, err := a.renderField(child, options, level, false)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, rendered)
+	}
+	return children, nil
+}
+
+// renderField renders a field and its children with the template for its type
+func (a *Alpaca) renderField(f *Field, options RenderOptions, level int, inTable bool) (template.HTML, error) {
+	data := RenderField{
+		Field:   f,
+		ID:      f.ID,
+		Title:   f.Title,
+		Type:    f.Type,
+		Level:   level,
+		InTable: inTable,
+	}
+	if level > 6 {
+		data.Level = 6
+	}
+
+	kind := "field"
+	var err error
+	switch {
+	case f.IsRepeatable() && f.Schema.Exists("items", "properties"):
+		kind = "table"
+		err = a.renderTable(f, options, level, &data)
+	case f.IsRepeatable() && f.Schema.Exists("items"):
+		kind = "list"
+		data.Children, err = a.renderChildren(f, options, level+1)
+	case f.IsContainerField && !f.IsAnswer() && f.Type == "object":
+		kind = "section"
+		data.Children, err = a.renderChildren(f, options, level+1)
+	default:
+		data.Value = f.DisplayValue(options.Raw)
+		if isImageDataURI(data.Value) {
+			data.Image = template.URL(data.Value)
+		}
+		for _, media := range f.Media {
+			data.Media = append(data.Media, media.RenderMedia())
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := options.lookup(f.Type, kind).Execute(buffer, data); err != nil {
+		return "", err
+	}
+	return template.HTML(buffer.String()), nil
+}
+
+// renderTable lays out the items of a repeatable as rows with a column per item property
+func (a *Alpaca) renderTable(f *Field, options RenderOptions, level int, data *RenderField) error {
+	properties := f.Schema.S("items", "properties")
+	keys := a.order.keys(properties)
+	for _, key := range keys {
+		title := cast.ToString(properties.S(key, "title").Data())
+		if title == "" {
+			title = key
+		}
+		data.Columns = append(data.Columns, title)
+	}
+
+	for _, item := range f.Children {
+		children := map[string]*Field{}
+		for _, child := range item.Children {
+			children[child.Key] = child
+		}
+
+		row := []template.HTML{}
+		for _, key := range keys {
+			cell := template.HTML("")
+			if child, ok := children[key]; ok && child.Type != "information" && child.Type != "image" {
+				rendered, err := a.renderField(child, options, level+1, true)
+				if err != nil {
+					return err
+				}
+				cell = rendered
+			}
+			row = append(row, cell)
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return nil
+}
+
+// DisplayValue returns the answer of a field as shown to people, using enum labels unless raw values are asked for
+func (f *Field) DisplayValue(raw bool) string {
+	if !raw && f.EnumLabel != "" {
+		return f.EnumLabel
+	}
+
+	switch v := f.Value.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case []interface{}:
+		return strings.Join(cast.ToStringSlice(v), ", ")
+	case map[string]interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	return cast.ToString(f.Value)
+}
+
+// renderImageTypes are the image types answers may be shown inline as, others could carry script like SVG can
+var renderImageTypes = []string{"image/png", "image/jpeg", "image/gif"}
+
+// isImageDataURI reports whether a value is a base64 data URI of an image type that is safe to show inline
+func isImageDataURI(value string) bool {
+	for _, mime := range renderImageTypes {
+		prefix := "data:" + mime + ";base64,"
+		if strings.HasPrefix(value, prefix) {
+			_, err := base64.StdEncoding.DecodeString(value[len(prefix):])
+			return err == nil
+		}
+	}
+	return false
+}
+
+// RenderMedia returns the image as a data URI that can be shown inline
+func (m ImageFile) RenderMedia() RenderMedia {
+	contents, _ := hex.DecodeString(m.Data)
+	return RenderMedia{
+		Name:   m.Name,
+		Src:    template.URL("data:" + m.Mime + ";base64," + base64.StdEncoding.EncodeToString(contents)),
+		Width:  m.Width,
+		Height: m.Height,
+	}
+}
@@ -0,0 +1,249 @@
+package alpaca
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaFromStruct generates the schema and options of a form from the tagged fields of a struct, so the
+// same struct can decode its submissions. Combine them as {"schema":...,"options":...} for AlpacaOptions.
+//
+// The alpaca tag names the property, followed by ",required" for required fields. The title, order, format and
+// type tags set the matching schema and options attributes, enum and optionLabels take values separated by |.
+// Slices hold any number of items unless limited by a maxItems tag. Untagged fields are left out.
+//
+//	Location string `alpaca:"location,required" title:"Location" enum:"External|Internal" order:"3"`
+func SchemaFromStruct(v interface{}) (schema []byte, options []byte, err error) {
+	rt := reflect.TypeOf(v)
+	for rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return nil, nil, ErrStructInvalid
+	}
+
+	schemaObject, optionsObject, err := structSchema(rt, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if schema, err = json.Marshal(schemaObject); err != nil {
+		return nil, nil, err
+	}
+	if options, err = json.Marshal(optionsObject); err != nil {
+		return nil, nil, err
+	}
+	return schema, options, nil
+}
+
+// Set adds a key to an ordered object, keeping the position of keys already set
+func (o *OrderedObject) Set(key string, value interface{}) {
+	if o.Values == nil {
+		o.Values = map[string]interface{}{}
+	}
+	if _, exists := o.Values[key]; !exists {
+		o.Keys = append(o.Keys, key)
+	}
+	o.Values[key] = value
+}
+
+// structSchema returns the object schema and options of a struct, properties following the field order
+func structSchema(rt reflect.Type, seen map[reflect.Type]bool) (OrderedObject, OrderedObject, error) {
+	if seen[rt] {
+		return OrderedObject{}, OrderedObject{}, &StructTagError{Type: rt.String(), Err: ErrStructRecursive}
+	}
+	seen[rt] = true
+	defer delete(seen, rt)
+
+	schema := OrderedObject{}
+	schema.Set("type", "object")
+	properties := OrderedObject{}
+	fields := OrderedObject{}
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup("alpaca")
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		key := parts[0]
+		if key == "" || strings.ContainsAny(key, ".[]") {
+			return schema, fields, &StructTagError{Type: rt.String(), Field: field.Name, Err: ErrStructTagInvalid}
+		}
+
+		propertySchema, propertyOptions, err := fieldSchema(field.Type, field.Tag, seen)
+		if err != nil {
+			if tagError, ok := err.(*StructTagError); ok && tagError.Field == "" {
+				tagError.Type, tagError.Field = rt.String(), field.Name
+			}
+			return schema, fields, err
+		}
+		for _, flag := range parts[1:] {
+			if flag == "required" {
+				propertySchema.Set("required", true)
+			}
+		}
+
+		properties.Set(key, propertySchema)
+		if len(propertyOptions.Keys) > 0 {
+			fields.Set(key, propertyOptions)
+		}
+	}
+
+	schema.Set("properties", properties)
+	options := OrderedObject{}
+	if len(fields.Keys) > 0 {
+		options.Set("fields", fields)
+	}
+	return schema, options, nil
+}
+
+// fieldSchema returns the schema and options of a struct field from its Go type and tags
+func fieldSchema(rt reflect.Type, tag reflect.StructTag, seen map[reflect.Type]bool) (OrderedObject, OrderedObject, error) {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	schema := OrderedObject{}
+	options := OrderedObject{}
+	if title, ok := tag.Lookup("title"); ok {
+		schema.Set("title", title)
+	}
+
+	schemaType := ""
+	switch {
+	case rt == timeType:
+		schemaType = "string"
+		schema.Set("type", schemaType)
+		schema.Set("format", "datetime")
+	case rt == mediaType || rt == imageFileList || rt == imageFileType:
+		schemaType = "string"
+		schema.Set("type", schemaType)
+		options.Set("type", "camera")
+	case rt.Kind() == reflect.Struct:
+		object, objectOptions, err := structSchema(rt, seen)
+		if err != nil {
+			return schema, options, err
+		}
+		for _, key := range object.Keys {
+			schema.Set(key, object.Values[key])
+		}
+		for _, key := range objectOptions.Keys {
+			options.Set(key, objectOptions.Values[key])
+		}
+	case rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array:
+		schema.Set("type", "array")
+		// Enums describe the items of multi-value answers
+		items, itemOptions, err := fieldSchema(rt.Elem(), reflect.StructTag(""), seen)
+		if err != nil {
+			return schema, options, err
+		}
+		if err := setEnum(&items, &options, tag); err != nil {
+			return schema, options, err
+		}
+		if _, isEnum := items.Values["enum"]; isEnum {
+			options.Set("type", "checkbox")
+		}
+		schema.Set("items", items)
+		// Arrays hold as many items as they have elements, slices as many as their maxItems tag allows
+		if maxItems, ok := tag.Lookup("maxItems"); ok {
+			number, err := strconv.Atoi(maxItems)
+			if err != nil || number < 0 {
+				return schema, options, &StructTagError{Err: ErrStructTagInvalid}
+			}
+			schema.Set("maxItems", number)
+		} else if rt.Kind() == reflect.Array {
+			schema.Set("maxItems", rt.Len())
+		}
+		if len(itemOptions.Keys) > 0 {
+			options.Set("items", itemOptions)
+		}
+	default:
+		schemaType = goSchemaType(rt)
+		if schemaType == "" {
+			return schema, options, &StructTagError{Err: ErrStructTypeInvalid}
+		}
+		schema.Set("type", schemaType)
+		if err := setEnum(&schema, &options, tag); err != nil {
+			return schema, options, err
+		}
+	}
+
+	if format, ok := tag.Lookup("format"); ok {
+		schema.Set("format", format)
+	}
+	if fieldType, ok := tag.Lookup("type"); ok {
+		options.Set("type", fieldType)
+	}
+	if order, ok := tag.Lookup("order"); ok {
+		number, err := strconv.ParseFloat(order, 64)
+		if err != nil {
+			return schema, options, &StructTagError{Err: ErrStructTagInvalid}
+		}
+		options.Set("order", number)
+	}
+
+	return schema, options, nil
+}
+
+// setEnum adds the enum and optionLabels tags to a schema and its options, typing enum values from the schema
+func setEnum(schema *OrderedObject, options *OrderedObject, tag reflect.StructTag) error {
+	if enum, ok := tag.Lookup("enum"); ok {
+		schemaType, _ := schema.Values["type"].(string)
+		values := []interface{}{}
+		for _, value := range strings.Split(enum, "|") {
+			if schemaType == "string" || schemaType == "" {
+				values = append(values, value)
+				continue
+			}
+			coerced, err := CoerceValue(value, schemaType)
+			if err != nil {
+				return &StructTagError{Err: ErrStructTagInvalid}
+			}
+			values = append(values, coerced)
+		}
+		schema.Set("enum", values)
+	}
+	if labels, ok := tag.Lookup("optionLabels"); ok {
+		options.Set("optionLabels", strings.Split(labels, "|"))
+	}
+	return nil
+}
+
+// goSchemaType returns the schema type of a Go scalar type
+func goSchemaType(rt reflect.Type) string {
+	switch rt.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Interface:
+		return "any"
+	}
+	return ""
+}
+
+// StructTagError reports a struct field that cannot be described by a schema
+type StructTagError struct {
+	Type  string
+	Field string
+	Err   error
+}
+
+func (e *StructTagError) Error() string {
+	return e.Type + "." + e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error so it can be matched with errors.Is
+func (e *StructTagError) Unwrap() error {
+	return e.Err
+}
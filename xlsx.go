@@ -0,0 +1,369 @@
+package alpaca
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXOptions configures an XLSXExporter
+type XLSXOptions struct {
+	// MaxItems caps the items of each repeatable written to its sheet, 0 writing every item
+	MaxItems int
+	// Labels writes enum labels rather than submitted values
+	Labels bool
+	// MediaURL returns the address of a photo, which makes its cell a link. Cells list media names without it.
+	MediaURL func(ImageFile) string
+}
+
+// XLSXExporter writes submissions of a form as an Excel workbook. The main sheet holds the top level answers
+// and each repeatable has a sheet of its own, linked to the main sheet by submission and item index.
+type XLSXExporter struct {
+	options XLSXOptions
+	layout  *exportLayout
+}
+
+// XLSXMainSheet is the name of the sheet holding the top level answers
+const XLSXMainSheet = "Answers"
+
+// xlsxStyles are the cell formats of the workbook, indexed by the s attribute of cells
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+	xlsxStyleDateTime
+	xlsxStyleTime
+)
+
+// xlsxEpoch is the date Excel counts days from
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxCell is a typed worksheet cell
+type xlsxCell struct {
+	Type    string
+	Value   string
+	Style   int
+	Formula string
+}
+
+// NewXLSXExporter derives the sheets and columns of a form from its schema
+func NewXLSXExporter(schema string, options XLSXOptions) (*XLSXExporter, error) {
+	layout, err := newExportLayout(schema, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return &XLSXExporter{options: options, layout: layout}, nil
+}
+
+// Write writes the submissions as an .xlsx workbook
+func (e *XLSXExporter) Write(w io.Writer, submissions []Submission) error {
+	names := []string{XLSXMainSheet}
+	sheets := [][][]xlsxCell{{e.header([]string{"Submission"}, e.layout.Main)}}
+	for _, table := range e.layout.Tables {
+		names = append(names, xlsxSheetName(table.Name, names))
+		sheets = append(sheets, [][]xlsxCell{e.header([]string{"Submission", "Parent", "Item"}, table)})
+	}
+
+	for _, submission := range submissions {
+		id := xlsxString(submission.ID)
+		sheets[0] = append(sheets[0], e.row([]xlsxCell{id}, e.layout.Main.rows(submission.Form, false)[0]))
+		for i, table := range e.layout.Tables {
+			for _, row := range table.rows(submission.Form, true) {
+				if e.options.MaxItems > 0 && row.Index >= e.options.MaxItems {
+					continue
+				}
+				link := []xlsxCell{id, xlsxString(row.Parent), {Value: strconv.Itoa(row.Index)}}
+				sheets[i+1] = append(sheets[i+1], e.row(link, row))
+			}
+		}
+	}
+
+	archive := zip.NewWriter(w)
+	files := map[string]string{
+		"[Content_Types].xml":        xlsxContentTypes(len(sheets)),
+		"_rels/.rels":                xlsxRootRels,
+		"xl/workbook.xml":            xlsxWorkbook(names),
+		"xl/_rels/workbook.xml.rels": xlsxWorkbookRels(len(sheets)),
+		"xl/styles.xml":              xlsxStyles,
+	}
+	for i, sheet := range sheets {
+		files["xl/worksheets/sheet"+strconv.Itoa(i+1)+".xml"] = xlsxSheet(sheet)
+	}
+
+	// Write parts in a fixed order so workbooks of the same submissions are identical
+	parts := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"}
+	for i := range sheets {
+		parts = append(parts, "xl/worksheets/sheet"+strconv.Itoa(i+1)+".xml")
+	}
+	for _, name := range parts {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, files[name]); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// header returns the header row of a table, titled from the fields
+func (e *XLSXExporter) header(link []string, table *exportTable) []xlsxCell {
+	cells := []xlsxCell{}
+	for _, title := range link {
+		cells = append(cells, xlsxCell{Type: "inlineStr", Value: title, Style: xlsxStyleHeader})
+	}
+	for _, column := range table.Columns {
+		title := column.Field.Title
+		if title == "" {
+			title = column.Path
+		}
+		if title == "" {
+			title = "Value"
+		}
+		cells = append(cells, xlsxCell{Type: "inlineStr", Value: title, Style: xlsxStyleHeader})
+	}
+	return cells
+}
+
+// row appends a cell for each answer of a row to the cells linking it to its submission
+func (e *XLSXExporter) row(cells []xlsxCell, row exportRow) []xlsxCell {
+	for _, f := range row.Fields {
+		cells = append(cells, e.cell(f))
+	}
+	return cells
+}
+
+// cell returns an answer as a cell typed from its schema. Numbers, booleans, dates and times are written as values
+// Excel can calculate with, photos as references to their media.
+func (e *XLSXExporter) cell(f *Field) xlsxCell {
+	if f == nil {
+		return xlsxCell{}
+	}
+
+	// Photos arrive with the request rather than in the data
+	if len(f.Media) > 0 {
+		return e.mediaCell(f.Media)
+	}
+	if !f.IsSubmitted() {
+		return xlsxCell{}
+	}
+
+	if !e.options.Labels || f.Enum == nil {
+		switch v := f.Value.(type) {
+		case float64:
+			if f.SchemaType == "number" || f.SchemaType == "integer" {
+				return xlsxCell{Value: strconv.FormatFloat(v, 'f', -1, 64)}
+			}
+		case bool:
+			if v {
+				return xlsxCell{Type: "b", Value: "1"}
+			}
+			return xlsxCell{Type: "b", Value: "0"}
+		case string:
+			switch f.Type {
+			case "date", "datetime", "time":
+				if t, err := f.Time(); err == nil {
+					return xlsxTimeCell(t, f.Type)
+				}
+			}
+		}
+	}
+
+	return xlsxString(f.ExportValue(e.options.Labels))
+}
+
+// mediaCell returns a cell referencing photos, linking to the first when media addresses are known
+func (e *XLSXExporter) mediaCell(media []ImageFile) xlsxCell {
+	names := []string{}
+	for _, file := range media {
+		names = append(names, file.Name)
+	}
+	cell := xlsxString(strings.Join(names, ", "))
+
+	if e.options.MediaURL != nil {
+		url := e.options.MediaURL(media[0])
+		cell.Type = "str"
+		cell.Formula = "HYPERLINK(" + xlsxFormulaString(url) + "," + xlsxFormulaString(cell.Value) + ")"
+	}
+	return cell
+}
+
+// xlsxString returns a text cell
+func xlsxString(value string) xlsxCell {
+	if value == "" {
+		return xlsxCell{}
+	}
+	return xlsxCell{Type: "inlineStr", Value: value}
+}
+
+// xlsxTimeCell returns a date, datetime or time as an Excel serial number with a matching format
+func xlsxTimeCell(t time.Time, kind string) xlsxCell {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	days := wall.Sub(xlsxEpoch).Hours() / 24
+
+	style := xlsxStyleDateTime
+	switch kind {
+	case "date":
+		style = xlsxStyleDate
+	case "time":
+		// Times have no date, only the fraction of the day
+		style = xlsxStyleTime
+		days = float64(t.Hour()*3600+t.Minute()*60+t.Second()) / 86400
+	}
+	return xlsxCell{Value: strconv.FormatFloat(days, 'f', -1, 64), Style: style}
+}
+
+// xlsxFormulaString quotes text for use in a formula
+func xlsxFormulaString(value string) string {
+	return `"` + strings.Replace(value, `"`, `""`, -1) + `"`
+}
+
+// xlsxSheetName returns a valid and unique sheet name for a repeatable
+func xlsxSheetName(path string, taken []string) string {
+	name := strings.NewReplacer("[]", "", "[", "", "]", "", ":", " ", "*", " ", "?", " ", "/", " ", "\\", " ").Replace(path)
+	if name == "" {
+		name = "Items"
+	}
+	runes := []rune(name)
+	if len(runes) > 31 {
+		runes = runes[len(runes)-31:]
+	}
+
+	unique := string(runes)
+	for i := 2; ; i++ {
+		clash := false
+		for _, other := range taken {
+			if strings.EqualFold(other, unique) {
+				clash = true
+				break
+			}
+		}
+		if !clash {
+			return unique
+		}
+		suffix := " " + strconv.Itoa(i)
+		if len(runes)+len(suffix) > 31 {
+			unique = string(runes[:31-len(suffix)]) + suffix
+		} else {
+			unique = string(runes) + suffix
+		}
+	}
+}
+
+// xlsxColumn returns the letters of a zero based column index, e.g. 0 is A and 26 is AA
+func xlsxColumn(index int) string {
+	column := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		column = string(rune('A'+(index-1)%26)) + column
+	}
+	return column
+}
+
+// xlsxEscape escapes text for XML
+func xlsxEscape(value string) string {
+	buffer := new(bytes.Buffer)
+	xml.EscapeText(buffer, []byte(value))
+	return buffer.String()
+}
+
+// xlsxSheet returns the XML of a worksheet
+func xlsxSheet(rows [][]xlsxCell) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(xml.Header)
+	buffer.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(buffer, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			if cell.Value == "" && cell.Formula == "" {
+				continue
+			}
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			fmt.Fprintf(buffer, `<c r="%s"`, ref)
+			if cell.Style != xlsxStyleDefault {
+				fmt.Fprintf(buffer, ` s="%d"`, cell.Style)
+			}
+			if cell.Type != "" {
+				fmt.Fprintf(buffer, ` t="%s"`, cell.Type)
+			}
+			buffer.WriteString(">")
+			switch {
+			case cell.Formula != "":
+				fmt.Fprintf(buffer, `<f>%s</f><v>%s</v>`, xlsxEscape(cell.Formula), xlsxEscape(cell.Value))
+			case cell.Type == "inlineStr":
+				fmt.Fprintf(buffer, `<is><t xml:space="preserve">%s</t></is>`, xlsxEscape(cell.Value))
+			default:
+				fmt.Fprintf(buffer, `<v>%s</v>`, xlsxEscape(cell.Value))
+			}
+			buffer.WriteString("</c>")
+		}
+		buffer.WriteString("</row>")
+	}
+	buffer.WriteString(`</sheetData></worksheet>`)
+	return buffer.String()
+}
+
+// xlsxWorkbook returns the XML of the workbook listing its sheets
+func xlsxWorkbook(names []string) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(xml.Header)
+	buffer.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range names {
+		fmt.Fprintf(buffer, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(name), i+1, i+1)
+	}
+	buffer.WriteString(`</sheets></workbook>`)
+	return buffer.String()
+}
+
+// xlsxWorkbookRels returns the relationships of the workbook to its sheets and styles
+func xlsxWorkbookRels(sheets int) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(xml.Header)
+	buffer.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(buffer, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(buffer, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	buffer.WriteString(`</Relationships>`)
+	return buffer.String()
+}
+
+// xlsxContentTypes returns the content types of the workbook parts
+func xlsxContentTypes(sheets int) string {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(xml.Header)
+	buffer.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(buffer, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	buffer.WriteString(`</Types>`)
+	return buffer.String()
+}
+
+// xlsxRootRels points the package at the workbook
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles holds the cell formats in the order of the xlsxStyle constants, using Excel's built in number formats
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="21" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs></styleSheet>`